@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+type archiveYear struct {
+	Year int `json:"year"`
+	Count int `json:"count"`
+	Months []archiveMonth `json:"months"`
+}
+
+type archiveMonth struct {
+	Month time.Month `json:"-"`
+	Name string `json:"month"`
+	Count int `json:"count"`
+	Posts []Post `json:"-"`
+	Summaries []postSummary `json:"posts"`
+}
+
+func buildArchive(posts []Post) []archiveYear {
+	sorted := make([]Post, len(posts))
+	copy(sorted, posts)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.After(sorted[j].Date)
+	})
+
+	var years []archiveYear
+	for _, post := range sorted {
+		year, month := post.Date.Year(), post.Date.Month()
+
+		if len(years) == 0 || years[len(years)-1].Year != year {
+			years = append(years, archiveYear{Year: year})
+		}
+		y := &years[len(years)-1]
+
+		if len(y.Months) == 0 || y.Months[len(y.Months)-1].Month != month {
+			y.Months = append(y.Months, archiveMonth{Month: month, Name: month.String()})
+		}
+		m := &y.Months[len(y.Months)-1]
+
+		m.Posts = append(m.Posts, post)
+		m.Summaries = append(m.Summaries, newPostSummary(post))
+		m.Count++
+		y.Count++
+	}
+	return years
+}
@@ -0,0 +1,78 @@
+package blog
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// emojiShortcodes maps :shortcode: names to the emoji they render as. Add
+// entries here to support more codes.
+var emojiShortcodes = map[string]string{
+	"smile": "😄",
+	"grin": "😁",
+	"joy": "😂",
+	"wink": "😉",
+	"heart": "❤️",
+	"thumbsup": "👍",
+	"+1": "👍",
+	"thumbsdown": "👎",
+	"-1": "👎",
+	"tada": "🎉",
+	"rocket": "🚀",
+	"fire": "🔥",
+	"star": "⭐",
+	"sparkles": "✨",
+	"eyes": "👀",
+	"thinking": "🤔",
+	"warning": "⚠️",
+	"bulb": "💡",
+	"memo": "📝",
+	"bug": "🐛",
+	"wave": "👋",
+	"coffee": "☕",
+	"check": "✔️",
+	"x": "❌",
+	"100": "💯",
+}
+
+var shortcodeRe = regexp.MustCompile(`:([a-z0-9_+\-]+):`)
+
+func replaceEmoji(doc ast.Node) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		text, ok := node.(*ast.Text)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+
+		var out []byte
+		last := 0
+		for _, loc := range shortcodeRe.FindAllIndex(text.Literal, -1) {
+			emoji, ok := emojiShortcodes[string(text.Literal[loc[0]+1:loc[1]-1])]
+			if !ok || !wordBoundary(text.Literal, loc[0], loc[1]) {
+				continue
+			}
+			out = append(out, text.Literal[last:loc[0]]...)
+			out = append(out, emoji...)
+			last = loc[1]
+		}
+		if out != nil {
+			text.Literal = append(out, text.Literal[last:]...)
+		}
+		return ast.GoToNext
+	})
+}
+
+// wordBoundary reports whether text[start:end] stands apart from the words
+// around it, so times and ratios like 10:100:20 aren't read as shortcodes.
+func wordBoundary(text []byte, start, end int) bool {
+	before, _ := utf8.DecodeLastRune(text[:start])
+	after, _ := utf8.DecodeRune(text[end:])
+	return (start == 0 || !isWordRune(before)) && (end == len(text) || !isWordRune(after))
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
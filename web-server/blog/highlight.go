@@ -0,0 +1,49 @@
+package blog
+
+import (
+	"io"
+	"log"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+var CodeTheme = "github"
+
+func highlightCodeHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	block, ok := node.(*ast.CodeBlock)
+	if !ok {
+		return ast.GoToNext, false
+	}
+
+	lang := strings.Fields(string(block.Info))
+	if len(lang) == 0 {
+		return ast.GoToNext, false
+	}
+
+	lexer := lexers.Get(lang[0])
+	if lexer == nil {
+		return ast.GoToNext, false
+	}
+
+	if err := highlightCode(w, lexer, string(block.Literal)); err != nil {
+		log.Printf("Error highlighting %s code block: %v", lang[0], err)
+		return ast.GoToNext, false
+	}
+	return ast.GoToNext, true
+}
+
+func highlightCode(w io.Writer, lexer chroma.Lexer, code string) error {
+	style := styles.Get(CodeTheme)
+	formatter := chromahtml.New(chromahtml.WithClasses(false))
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return err
+	}
+	return formatter.Format(w, style, iterator)
+}
@@ -0,0 +1,17 @@
+package blog
+
+import (
+	"github.com/gomarkdown/markdown/ast"
+)
+
+func firstImage(doc ast.Node) string {
+	var src string
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if img, ok := node.(*ast.Image); ok && entering && len(img.Destination) > 0 {
+			src = string(img.Destination)
+			return ast.Terminate
+		}
+		return ast.GoToNext
+	})
+	return src
+}
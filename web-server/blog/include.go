@@ -0,0 +1,60 @@
+package blog
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// SnippetsDir is where include shortcodes are resolved from.
+var SnippetsDir = "snippets"
+
+const maxIncludeDepth = 5
+
+var includeRe = regexp.MustCompile(`\{\{<\s*include\s+"([^"]+)"\s*>\}\}`)
+
+// codeRe matches fenced code blocks and inline code spans, where a shortcode
+// is being shown rather than used.
+var codeRe = regexp.MustCompile("(?ms)^(?:```|~~~).*?^(?:```|~~~)|``[^\n]*?``|`[^`\n]*`")
+
+// ExpandIncludes inlines {{< include "file.md" >}} shortcodes with the named
+// file from SnippetsDir. Paths may not leave that directory, and nesting
+// stops after maxIncludeDepth levels so a cycle can't recurse forever.
+func ExpandIncludes(body []byte) []byte {
+	return expandIncludes(body, 0)
+}
+
+func expandIncludes(body []byte, depth int) []byte {
+	var out []byte
+	last := 0
+	for _, loc := range codeRe.FindAllIndex(body, -1) {
+		out = append(out, expandShortcodes(body[last:loc[0]], depth)...)
+		out = append(out, body[loc[0]:loc[1]]...)
+		last = loc[1]
+	}
+	return append(out, expandShortcodes(body[last:], depth)...)
+}
+
+func expandShortcodes(body []byte, depth int) []byte {
+	return includeRe.ReplaceAllFunc(body, func(shortcode []byte) []byte {
+		name := string(includeRe.FindSubmatch(shortcode)[1])
+		if depth >= maxIncludeDepth {
+			log.Printf("Skipping include %q: nested more than %d deep", name, maxIncludeDepth)
+			return shortcode
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			log.Printf("Skipping include %q: path must stay inside %s", name, SnippetsDir)
+			return shortcode
+		}
+
+		content, err := os.ReadFile(filepath.Join(SnippetsDir, filepath.FromSlash(name)))
+		if err != nil {
+			log.Printf("Error reading include %q: %v", name, err)
+			return shortcode
+		}
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+		return expandIncludes(bytes.TrimRight(content, "\n"), depth+1)
+	})
+}
@@ -0,0 +1,22 @@
+package blog
+
+import "testing"
+
+func TestIncludeSkipsCode(t *testing.T) {
+	old := SnippetsDir
+	SnippetsDir = writeDocs(t, map[string]string{"d.md": "SNIPPET"})
+	t.Cleanup(func() { SnippetsDir = old })
+
+	body := "Use {{< include \"d.md\" >}} here.\n\n" +
+		"Write `{{< include \"d.md\" >}}` to include it:\n\n" +
+		"```\n{{< include \"d.md\" >}}\n```\n\n" +
+		"And {{< include \"d.md\" >}} again.\n"
+	want := "Use SNIPPET here.\n\n" +
+		"Write `{{< include \"d.md\" >}}` to include it:\n\n" +
+		"```\n{{< include \"d.md\" >}}\n```\n\n" +
+		"And SNIPPET again.\n"
+
+	if got := string(ExpandIncludes([]byte(body))); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
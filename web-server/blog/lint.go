@@ -0,0 +1,35 @@
+package blog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Lint reports accessibility problems in a post's markdown: images without
+// alt text and headings that skip a level.
+func Lint(post Post) []string {
+	var issues []string
+	prevLevel := 0
+
+	ast.WalkFunc(parseMarkdown([]byte(post.Markdown)), func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+
+		switch n := node.(type) {
+		case *ast.Image:
+			if strings.TrimSpace(nodeText(n)) == "" {
+				issues = append(issues, fmt.Sprintf("image %q has no alt text", n.Destination))
+			}
+		case *ast.Heading:
+			if prevLevel > 0 && n.Level > prevLevel+1 {
+				issues = append(issues, fmt.Sprintf("heading %q jumps from h%d to h%d", nodeText(n), prevLevel, n.Level))
+			}
+			prevLevel = n.Level
+		}
+		return ast.GoToNext
+	})
+	return issues
+}
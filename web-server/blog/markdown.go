@@ -0,0 +1,119 @@
+package blog
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// BasePath is the URL prefix relative image sources are resolved against.
+var BasePath string
+
+// Extensions is the set of parser extensions used for every document.
+var Extensions = parser.CommonExtensions | parser.AutoHeadingIDs | parser.Footnotes
+
+// RenderError reports a document that couldn't be rendered, as opposed to a
+// file that couldn't be read.
+type RenderError struct {
+	Err error
+}
+
+func (e *RenderError) Error() string {
+	return "rendering markdown: " + e.Err.Error()
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// recoverRender turns a panic in the parser or renderer into a RenderError.
+func recoverRender(err *error) {
+	if r := recover(); r != nil {
+		*err = &RenderError{Err: fmt.Errorf("%v", r)}
+	}
+}
+
+// MdToHtml renders a markdown document to HTML.
+func MdToHtml(md []byte) (out []byte, err error) {
+	defer recoverRender(&err)
+	return renderMarkdown(parseMarkdown(md)), nil
+}
+
+func parseMarkdown(md []byte) ast.Node {
+	p := parser.NewWithExtensions(Extensions)
+	p.RegisterInline('$', inlineMath)
+	doc := p.Parse(md)
+	replaceEmoji(doc)
+	return doc
+}
+
+func renderMarkdown(doc ast.Node) []byte {
+	htmlFlags := html.CommonFlags | html.HrefTargetBlank | html.FootnoteReturnLinks
+	opts := html.RendererOptions{
+		Flags: htmlFlags,
+		FootnoteReturnLinkContents: "↩",
+		RenderNodeHook: highlightCodeHook,
+	}
+	renderer := html.NewRenderer(opts)
+
+	out := markdown.Render(doc, renderer)
+	out = wrapTables(out)
+	out = headingAnchors(out)
+	out = lazyImages(out)
+	out = sanitizeHTML(out)
+	return []byte(MinifyHTML(string(out)))
+}
+
+var (
+	headingRe = regexp.MustCompile(`(?s)<h([23])\b([^>]*)>(.*?)</h[23]>`)
+	headingIDRe = regexp.MustCompile(`\sid="([^"]+)"`)
+	imgTagRe = regexp.MustCompile(`<img\b[^>]*>`)
+	imgSrcRe = regexp.MustCompile(`\ssrc="([^"]*)"`)
+)
+
+// lazyImages defers offscreen image loading and resolves relative sources
+// against the base path. Tags that already set loading are left alone.
+func lazyImages(out []byte) []byte {
+	return imgTagRe.ReplaceAllFunc(out, func(tag []byte) []byte {
+		if bytes.Contains(tag, []byte(" loading=")) {
+			return tag
+		}
+		tag = imgSrcRe.ReplaceAllFunc(tag, func(attr []byte) []byte {
+			src := string(imgSrcRe.FindSubmatch(attr)[1])
+			u, err := url.Parse(src)
+			if err != nil || u.Scheme != "" || u.Host != "" || src == "" || strings.HasPrefix(src, "#") {
+				return attr
+			}
+			return []byte(` src="` + BasePath + "/" + strings.TrimPrefix(src, "/") + `"`)
+		})
+		return append([]byte(`<img loading="lazy" decoding="async"`), tag[len("<img"):]...)
+	})
+}
+
+// headingAnchors appends a "#" link to each H2 and H3 that has an id, so
+// sections can be shared by deep link. Headings that already have one are
+// left alone.
+func headingAnchors(out []byte) []byte {
+	return headingRe.ReplaceAllFunc(out, func(tag []byte) []byte {
+		m := headingRe.FindSubmatch(tag)
+		id := headingIDRe.FindSubmatch(m[2])
+		if id == nil || bytes.Contains(m[3], []byte(`class="heading-anchor"`)) {
+			return tag
+		}
+		anchor := ` <a class="heading-anchor" href="#` + string(id[1]) + `" aria-label="Link to this section">#</a>`
+		return []byte("<h" + string(m[1]) + string(m[2]) + ">" + string(m[3]) + anchor + "</h" + string(m[1]) + ">")
+	})
+}
+
+func wrapTables(out []byte) []byte {
+	out = bytes.ReplaceAll(out, []byte("<table>"), []byte(`<div class="table-responsive"><table>`))
+	out = bytes.ReplaceAll(out, []byte("</table>"), []byte("</table></div>"))
+	return out
+}
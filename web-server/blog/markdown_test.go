@@ -0,0 +1,65 @@
+package blog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTwoFootnotes(t *testing.T) {
+	out, err := MdToHtml([]byte("First[^a] and second[^b].\n\n[^a]: One.\n[^b]: Two.\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(out)
+
+	for _, want := range []string{
+		`<sup class="footnote-ref" id="fnref:a"><a href="#fn:a">1</a></sup>`,
+		`<sup class="footnote-ref" id="fnref:b"><a href="#fn:b">2</a></sup>`,
+		`<li id="fn:a">`,
+		`<li id="fn:b">`,
+		`href="#fnref:a"`,
+		`href="#fnref:b"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("missing %s in:\n%s", want, html)
+		}
+	}
+}
+
+func TestTableWrapper(t *testing.T) {
+	out, err := MdToHtml([]byte("| Name | Value |\n|------|-------|\n| a | 1 |\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(out)
+
+	if !strings.Contains(html, `<div class="table-responsive"><table>`) || !strings.Contains(html, "</table></div>") {
+		t.Errorf("table not wrapped in table-responsive div:\n%s", html)
+	}
+	if !strings.Contains(html, "<th>Name</th>") || !strings.Contains(html, "<td>1</td>") {
+		t.Errorf("table cells missing:\n%s", html)
+	}
+}
+
+func TestEmojiShortcodeNeedsBoundaries(t *testing.T) {
+	tests := []struct {
+		in string
+		want string
+	}{
+		{"Ship it :rocket:!", "Ship it 🚀!"},
+		{":tada::100:", "🎉💯"},
+		{"Meet at 10:100:20.", "Meet at 10:100:20."},
+		{"a:x:b", "a:x:b"},
+		{"`:smile:` stays", "<code>:smile:</code> stays"},
+	}
+
+	for _, tt := range tests {
+		out, err := MdToHtml([]byte(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(out); !strings.Contains(got, tt.want) {
+			t.Errorf("%q rendered as %q, want it to contain %q", tt.in, got, tt.want)
+		}
+	}
+}
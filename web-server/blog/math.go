@@ -0,0 +1,75 @@
+package blog
+
+import (
+	"bytes"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// inlineMath parses $...$ spans like pandoc does: the opening $ must not be
+// followed by a space and the closing $ must not be preceded by a space or
+// followed by a digit, so prices such as "$5 and $10" stay plain text.
+func inlineMath(p *parser.Parser, data []byte, offset int) (int, ast.Node) {
+	data = data[offset:]
+
+	if len(data) >= 2 && data[1] == '$' {
+		return displayMath(data)
+	}
+	if len(data) <= 2 || isSpace(data[1]) {
+		return 0, nil
+	}
+
+	for end := 1; end < len(data); end++ {
+		switch {
+		case data[end] == '\\':
+			end++
+		case data[end] == '$':
+			if isSpace(data[end-1]) || (end+1 < len(data) && isDigit(data[end+1])) {
+				return 0, nil
+			}
+			math := &ast.Math{}
+			math.Literal = data[1:end]
+			return end + 1, math
+		}
+	}
+	return 0, nil
+}
+
+// displayMath handles $$...$$ within a paragraph. The block parser only sees
+// $$ on lines of its own, and a math block can't nest inside a paragraph, so
+// this emits the same display span as raw HTML.
+func displayMath(data []byte) (int, ast.Node) {
+	for end := 2; end+1 < len(data); end++ {
+		switch {
+		case data[end] == '\\':
+			end++
+		case data[end] == '$' && data[end+1] == '$':
+			if end == 2 {
+				break
+			}
+			var b bytes.Buffer
+			b.WriteString(`<span class="math display">\[`)
+			html.EscapeHTML(&b, data[2:end])
+			b.WriteString(`\]</span>`)
+			span := &ast.HTMLSpan{}
+			span.Literal = b.Bytes()
+			return end + 2, span
+		}
+	}
+
+	// Unclosed: keep both dollars as text rather than letting the second
+	// one open inline math.
+	text := &ast.Text{}
+	text.Literal = data[:2]
+	return 2, text
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,52 @@
+package blog
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/tdewolff/minify/v2"
+	minifyhtml "github.com/tdewolff/minify/v2/html"
+)
+
+var MinifyOutput bool
+
+var minifier = func() *minify.M {
+	m := minify.New()
+	m.Add("text/html", &minifyhtml.Minifier{
+		KeepDocumentTags: true,
+		KeepEndTags: true,
+		KeepQuotes: true,
+	})
+	return m
+}()
+
+var minifyStats struct {
+	before atomic.Int64
+	after atomic.Int64
+}
+
+// MinifyHTML minifies s when MinifyOutput is set and returns it unchanged otherwise.
+func MinifyHTML(s string) string {
+	if !MinifyOutput {
+		return s
+	}
+
+	out, err := minifier.String("text/html", s)
+	if err != nil {
+		log.Printf("Error minifying HTML: %v", err)
+		return s
+	}
+
+	minifyStats.before.Add(int64(len(s)))
+	minifyStats.after.Add(int64(len(out)))
+	return out
+}
+
+// LogMinifySavings logs and resets the bytes saved by minification since the last call.
+func LogMinifySavings() {
+	before, after := minifyStats.before.Swap(0), minifyStats.after.Swap(0)
+	if before == 0 {
+		return
+	}
+	log.Printf("Minified rendered posts from %d to %d bytes (%.1f%% smaller)", before, after, 100*float64(before-after)/float64(before))
+}
@@ -0,0 +1,546 @@
+// Package blog loads markdown posts from a directory and renders them to
+// HTML. The settings below are package-level so a caller can set them once,
+// the way the server binds them to its flags.
+package blog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	stdhtml "html"
+
+	"github.com/gomarkdown/markdown/ast"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	DefaultAuthor string
+	SiteImage string
+	WordsPerMinute = 200
+	PreviewLength = 150
+	LazyRender bool
+	FileExtensions = []string{".md", ".markdown"}
+	Languages []string
+	DefaultLang string
+	DateFormat = "Jan 2, 2006"
+)
+
+// Post is a markdown document loaded from the docs directory. The neighbour,
+// related and series fields are left for the caller to fill in.
+type Post struct {
+	Slug string
+	Path string
+	URL string
+	Canonical string
+	Title string
+	Category string
+	Author string
+	Series string
+	SeriesOrder int
+	Weight int
+	Content template.HTML
+	TOC template.HTML
+	Hash string
+	ReadingTime int
+	Date time.Time
+	DateFormatted string
+	DateISO string
+	Preview string
+	Description string
+	Excerpt template.HTML
+	Markdown string
+	Tags []string
+	Image string
+	Thumbnail string
+	CSS []string
+	JS []string
+	Draft bool
+	Pinned bool
+	Lang string
+	Translations []Post
+	Meta map[string]any
+	PrevSlug string
+	PrevTitle string
+	NextSlug string
+	NextTitle string
+	Related []Post
+	SeriesPart int
+	SeriesTotal int
+	SeriesPrevSlug string
+	SeriesPrevTitle string
+	SeriesNextSlug string
+	SeriesNextTitle string
+}
+
+// Render fills in the HTML of a post loaded with LazyRender set. Hash was
+// already set from the source at load, so it's left as is.
+func Render(post Post) Post {
+	if !LazyRender || post.Content != "" {
+		return post
+	}
+
+	key := sha256.Sum256([]byte(post.Markdown))
+	if v, ok := lazyContent.Load(key); ok {
+		rc := v.(renderedContent)
+		post.Content, post.TOC = rc.content, rc.toc
+		return post
+	}
+
+	rc, err := renderBody([]byte(post.Markdown))
+	if err != nil {
+		log.Printf("Error rendering %s: %v", post.Path, err)
+		return post
+	}
+	lazyContent.Store(key, rc)
+	post.Content, post.TOC = rc.content, rc.toc
+	return post
+}
+
+// LoadPosts reads every markdown file under dir, pinned posts first and then
+// newest first. URL is left empty since it depends on where the posts are
+// served, as is Canonical unless front matter sets it.
+func LoadPosts(dir string) []Post {
+	var posts []Post
+	lazyContent.Clear()
+
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Error reading %s: %v", file, err)
+			return nil
+		}
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || !slices.Contains(FileExtensions, strings.ToLower(ext)) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			log.Printf("Error reading file %s: %v", rel, err)
+			return nil
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			log.Printf("Error reading file %s: %v", rel, err)
+			return nil
+		}
+
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+
+		if len(bytes.TrimSpace(content)) == 0 {
+			log.Printf("Skipping empty file %s", rel)
+			return nil
+		}
+
+		meta, body := ParseFrontMatter(content)
+		body = ExpandIncludes(body)
+		if strings.EqualFold(ext, ".mdx") {
+			body = stripMDXModules(body)
+		}
+
+		var rendered renderedContent
+		if LazyRender {
+			rendered.thumbnail = firstImage(parseMarkdown(body))
+			rendered.hash = sourceHash(body)
+		} else if rendered, err = renderBody(body); err != nil {
+			log.Printf("Skipping %s: %v", rel, err)
+			return nil
+		}
+		postExcerpt, err := excerpt(body)
+		if err != nil {
+			log.Printf("Skipping %s: %v", rel, err)
+			return nil
+		}
+		slug := strings.TrimSuffix(rel, ext)
+
+		fileDate, name, hasFileDate := dateFromFilename(path.Base(slug))
+		if hasFileDate {
+			slug = path.Join(path.Dir(slug), name)
+		}
+
+		lang, langRel := postLang(rel)
+		if l, ok := meta["lang"].(string); ok && l != "" && len(Languages) > 0 {
+			lang = strings.ToLower(l)
+		}
+
+		category := ""
+		if dir := path.Dir(langRel); dir != "." {
+			category = dir
+		}
+
+		title, preview := titleAndPreview(string(body), path.Base(slug))
+		if t, ok := meta["title"].(string); ok && t != "" {
+			title = t
+		}
+
+		description := preview
+		if d, ok := meta["description"].(string); ok && strings.TrimSpace(d) != "" {
+			description = strings.TrimSpace(d)
+		}
+
+		date := info.ModTime()
+		if hasFileDate {
+			date = fileDate
+		}
+		if d, ok := ParseDate(meta["date"]); ok {
+			date = d
+		}
+
+		author := DefaultAuthor
+		if a, ok := meta["author"].(string); ok && a != "" {
+			author = a
+		}
+
+		canonical, _ := meta["canonical"].(string)
+		if u, err := url.Parse(canonical); canonical != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			log.Printf("Ignoring invalid canonical URL %q in %s", canonical, rel)
+			canonical = ""
+		}
+
+		series, _ := meta["series"].(string)
+		seriesOrder, _ := meta["series_order"].(int)
+		weight, _ := meta["weight"].(int)
+
+		css, js := parseAssetURLs(slug, meta["css"]), parseAssetURLs(slug, meta["js"])
+		if Sanitize && len(css)+len(js) > 0 {
+			log.Printf("Warning: ignoring css/js front matter in %s since -sanitize is set", rel)
+			css, js = nil, nil
+		}
+
+		image := SiteImage
+		if img, ok := meta["image"].(string); ok && img != "" {
+			image = img
+		}
+
+		post := Post{
+			Slug: slug,
+			Path: rel,
+			Canonical: canonical,
+			Title: title,
+			Category: category,
+			Author: author,
+			Series: series,
+			SeriesOrder: seriesOrder,
+			Weight: weight,
+			Content: rendered.content,
+			TOC: rendered.toc,
+			Hash: rendered.hash,
+			ReadingTime: readingTime(body),
+			Date: date,
+			DateFormatted: date.Format(DateFormat),
+			DateISO: date.Format(time.RFC3339),
+			Preview: preview,
+			Description: description,
+			Excerpt: postExcerpt,
+			Markdown: string(body),
+			Tags: parseTags(meta["tags"]),
+			Image: image,
+			Thumbnail: rendered.thumbnail,
+			CSS: css,
+			JS: js,
+			Draft: meta["draft"] == true,
+			Pinned: meta["pinned"] == true,
+			Lang: lang,
+			Meta: meta,
+		}
+		posts = append(posts, post)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error reading docs directory: %v", err)
+	}
+
+	dedupeSlugs(posts)
+
+	sort.Slice(posts, func(i, j int) bool {
+		if posts[i].Pinned != posts[j].Pinned {
+			return posts[i].Pinned
+		}
+		return posts[i].Date.After(posts[j].Date)
+	})
+
+	return posts
+}
+
+// postLang picks the language from a leading Languages directory, e.g.
+// es/hola.md, and returns the path below it. Other posts get DefaultLang.
+func postLang(rel string) (string, string) {
+	if len(Languages) == 0 {
+		return "", rel
+	}
+
+	first, rest, ok := strings.Cut(rel, "/")
+	if ok && slices.Contains(Languages, strings.ToLower(first)) {
+		return strings.ToLower(first), rest
+	}
+	return DefaultLang, rel
+}
+
+// TranslationKey is a post's slug without its language directory, shared by
+// translations of the same post.
+func TranslationKey(post Post) string {
+	first, rest, ok := strings.Cut(post.Slug, "/")
+	if ok && slices.Contains(Languages, strings.ToLower(first)) {
+		return rest
+	}
+	return post.Slug
+}
+
+// stripMDXModules drops MDX import/export lines so the rest reads as plain
+// markdown; JSX elements are left to pass through as raw HTML.
+func stripMDXModules(body []byte) []byte {
+	var out [][]byte
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("import ")) || bytes.HasPrefix(line, []byte("export ")) {
+			continue
+		}
+		out = append(out, line)
+	}
+	return bytes.Join(out, []byte("\n"))
+}
+
+func dateFromFilename(name string) (time.Time, string, bool) {
+	const layout = "2006-01-02"
+	if len(name) <= len(layout)+1 || name[len(layout)] != '-' {
+		return time.Time{}, name, false
+	}
+
+	date, err := time.Parse(layout, name[:len(layout)])
+	if err != nil {
+		return time.Time{}, name, false
+	}
+	return date, name[len(layout)+1:], true
+}
+
+// dedupeSlugs compares slugs case-insensitively, the way requests are
+// matched, so Foo.md and foo.md don't shadow each other.
+func dedupeSlugs(posts []Post) {
+	seen := map[string]string{}
+	for i := range posts {
+		slug := posts[i].Slug
+		if first, ok := seen[strings.ToLower(slug)]; ok {
+			for n := 2; ; n++ {
+				candidate := fmt.Sprintf("%s-%d", slug, n)
+				if _, taken := seen[strings.ToLower(candidate)]; !taken {
+					slug = candidate
+					break
+				}
+			}
+			log.Printf("Warning: slug %q from %s collides with %s, using %q", posts[i].Slug, posts[i].Path, first, slug)
+			posts[i].Slug = slug
+		}
+		seen[strings.ToLower(slug)] = posts[i].Path
+	}
+}
+
+const moreDelimiter = "<!--more-->"
+
+func excerpt(body []byte) (template.HTML, error) {
+	before, _, found := bytes.Cut(body, []byte(moreDelimiter))
+	if !found {
+		return "", nil
+	}
+
+	before = bytes.TrimSpace(before)
+	if bytes.HasPrefix(before, []byte("# ")) {
+		_, before, _ = bytes.Cut(before, []byte("\n"))
+	}
+	out, err := MdToHtml(before)
+	return template.HTML(out), err
+}
+
+func titleAndPreview(body string, slug string) (string, string) {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	title := titleFromSlug(slug)
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "# ") {
+		title = strings.TrimSpace(strings.TrimPrefix(lines[0], "# "))
+		lines = lines[1:]
+	}
+
+	preview := ""
+	if len(lines) > 0 {
+		preview = Truncate(plainText(lines[0]), PreviewLength)
+	}
+
+	return title, preview
+}
+
+var rawTextTagRe = regexp.MustCompile(`(?i)^<(/?)(script|style)\b`)
+
+// plainText renders a markdown snippet down to its text content, dropping
+// formatting and raw HTML, including whatever sits inside <script> and
+// <style>, and decoding entities.
+func plainText(md string) string {
+	var b strings.Builder
+	inRawText := ""
+	ast.WalkFunc(parseMarkdown([]byte(md)), func(n ast.Node, entering bool) ast.WalkStatus {
+		switch n := n.(type) {
+		case *ast.HTMLSpan:
+			if m := rawTextTagRe.FindSubmatch(n.Literal); m != nil {
+				if len(m[1]) == 0 {
+					inRawText = strings.ToLower(string(m[2]))
+				} else if strings.EqualFold(string(m[2]), inRawText) {
+					inRawText = ""
+				}
+			}
+			return ast.GoToNext
+		case *ast.HTMLBlock:
+			return ast.GoToNext
+		}
+		if leaf := n.AsLeaf(); entering && leaf != nil && inRawText == "" {
+			b.Write(leaf.Literal)
+		}
+		return ast.GoToNext
+	})
+	return strings.Join(strings.Fields(stdhtml.UnescapeString(b.String())), " ")
+}
+
+func titleFromSlug(slug string) string {
+	words := strings.FieldsFunc(slug, func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// Truncate shortens s to at most n runes, ending on a whole word, and adds
+// an ellipsis when anything was cut.
+func Truncate(s string, n int) string {
+	n = max(n, 1)
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	// Back up to the last space so the preview ends on a whole word; a
+	// single oversized word (e.g. a URL) is still cut at the hard limit.
+	cut := n
+	for i := n; i > 0; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + "..."
+}
+
+var fencedCodeRe = regexp.MustCompile("(?ms)^(```|~~~).*?^(```|~~~)")
+
+func readingTime(body []byte) int {
+	words := len(strings.Fields(fencedCodeRe.ReplaceAllString(string(body), "")))
+	wpm := max(WordsPerMinute, 1)
+	return max((words+wpm-1)/wpm, 1)
+}
+
+// ParseFrontMatter splits a leading YAML block off content.
+func ParseFrontMatter(content []byte) (map[string]any, []byte) {
+	meta := map[string]any{}
+
+	if !bytes.HasPrefix(content, []byte("---\n")) {
+		return meta, content
+	}
+
+	rest := content[len("---\n"):]
+	end := bytes.Index(rest, []byte("\n---\n"))
+	if end == -1 {
+		return meta, content
+	}
+
+	if err := yaml.Unmarshal(rest[:end], &meta); err != nil {
+		log.Printf("Error parsing front matter: %v", err)
+		return map[string]any{}, content
+	}
+
+	body := bytes.TrimLeft(rest[end+len("\n---\n"):], "\n")
+	return meta, body
+}
+
+// ParseDate accepts a YAML timestamp or an RFC3339 or YYYY-MM-DD string.
+func ParseDate(v any) (time.Time, bool) {
+	switch d := v.(type) {
+	case time.Time:
+		return d, true
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if t, err := time.Parse(layout, d); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseTags(v any) []string {
+	var tags []string
+	switch t := v.(type) {
+	case []any:
+		for _, tag := range t {
+			if s, ok := tag.(string); ok {
+				tags = append(tags, strings.TrimSpace(s))
+			}
+		}
+	case string:
+		for _, tag := range strings.Split(t, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// parseAssetURLs accepts only http(s) or root-relative URLs so front matter
+// can't smuggle javascript: or data: payloads into the page.
+func parseAssetURLs(slug string, v any) []string {
+	var urls []string
+	for _, raw := range parseTags(v) {
+		u, err := url.Parse(raw)
+		if err != nil || strings.ContainsAny(raw, "<>\"'") {
+			log.Printf("Skipping invalid asset URL %q in %s", raw, slug)
+			continue
+		}
+		switch {
+		case u.Scheme == "http" || u.Scheme == "https":
+			if u.Host == "" {
+				log.Printf("Skipping invalid asset URL %q in %s", raw, slug)
+				continue
+			}
+		case u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/"):
+		default:
+			log.Printf("Skipping invalid asset URL %q in %s", raw, slug)
+			continue
+		}
+		urls = append(urls, u.String())
+	}
+	return urls
+}
+
@@ -0,0 +1,149 @@
+package blog
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func writeDocs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestTruncateEmojiStaysValidUTF8(t *testing.T) {
+	s := strings.Repeat("😀", 200)
+
+	got := Truncate(s, 150)
+	if !utf8.ValidString(got) {
+		t.Fatalf("Truncate produced invalid UTF-8: %q", got)
+	}
+	if want := strings.Repeat("😀", 150) + "..."; got != want {
+		t.Errorf("got %d runes, want 150 emoji and an ellipsis", utf8.RuneCountInString(got))
+	}
+}
+
+func TestDatedFilename(t *testing.T) {
+	posts := LoadPosts(writeDocs(t, map[string]string{
+		"2024-05-15-my-post.md": "# My Post\n\nBody.\n",
+	}))
+	if len(posts) != 1 {
+		t.Fatalf("got %d posts, want 1", len(posts))
+	}
+
+	if posts[0].Slug != "my-post" {
+		t.Errorf("slug %q, want my-post", posts[0].Slug)
+	}
+	if want := time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC); !posts[0].Date.Equal(want) {
+		t.Errorf("date %v, want %v", posts[0].Date, want)
+	}
+}
+
+func TestCRLFTitle(t *testing.T) {
+	posts := LoadPosts(writeDocs(t, map[string]string{
+		"windows.md": "---\r\ntags: [a]\r\n---\r\n# Windows Title\r\n\r\nA preview line.\r\n",
+	}))
+	if len(posts) != 1 {
+		t.Fatalf("got %d posts, want 1", len(posts))
+	}
+
+	if posts[0].Title != "Windows Title" {
+		t.Errorf("title %q, want %q", posts[0].Title, "Windows Title")
+	}
+	if strings.Contains(posts[0].Preview, "\r") {
+		t.Errorf("preview %q contains a carriage return", posts[0].Preview)
+	}
+	if len(posts[0].Tags) != 1 || posts[0].Tags[0] != "a" {
+		t.Errorf("tags %q, want [a] from CRLF front matter", posts[0].Tags)
+	}
+}
+
+func TestSanitizeDropsFrontMatterAssets(t *testing.T) {
+	Sanitize = true
+	t.Cleanup(func() { Sanitize = false })
+
+	posts := LoadPosts(writeDocs(t, map[string]string{
+		"assets.md": "---\ncss: [/extra.css]\njs: [https://evil.example/x.js]\n---\n# Assets\n\n<script>alert(1)</script>\n",
+	}))
+	if len(posts) != 1 {
+		t.Fatalf("got %d posts, want 1", len(posts))
+	}
+
+	if posts[0].CSS != nil || posts[0].JS != nil {
+		t.Errorf("got css %q js %q, want both dropped under -sanitize", posts[0].CSS, posts[0].JS)
+	}
+	if strings.Contains(string(posts[0].Content), "<script") {
+		t.Errorf("inline script survived sanitizing:\n%s", posts[0].Content)
+	}
+}
+
+func TestSlugCollisionIgnoresCase(t *testing.T) {
+	posts := LoadPosts(writeDocs(t, map[string]string{
+		"Foo.md": "# Upper\n\nOne.\n",
+		"foo.md": "# Lower\n\nTwo.\n",
+	}))
+	if len(posts) != 2 {
+		t.Fatalf("got %d posts, want 2", len(posts))
+	}
+
+	slugs := []string{posts[0].Slug, posts[1].Slug}
+	if strings.EqualFold(slugs[0], slugs[1]) {
+		t.Errorf("slugs %q differ only by case, want one renamed", slugs)
+	}
+	if !slices.Contains(slugs, "Foo-2") && !slices.Contains(slugs, "foo-2") {
+		t.Errorf("slugs %q, want one of them suffixed -2", slugs)
+	}
+}
+
+func TestLazyRenderMemoWithoutCache(t *testing.T) {
+	LazyRender = true
+	oldCache := renderCache
+	renderCache = nil
+	t.Cleanup(func() { LazyRender, renderCache = false, oldCache })
+
+	posts := LoadPosts(writeDocs(t, map[string]string{
+		"lazy.md": "# Lazy\n\nRendered *later*.\n",
+	}))
+	if len(posts) != 1 || posts[0].Content != "" {
+		t.Fatalf("want one post with no content before Render, got %+v", posts)
+	}
+
+	first := Render(posts[0])
+	if !strings.Contains(string(first.Content), "<em>later</em>") {
+		t.Fatalf("rendered content:\n%s", first.Content)
+	}
+	if _, ok := lazyContent.Load(sha256.Sum256([]byte(posts[0].Markdown))); !ok {
+		t.Fatal("lazy render wasn't memoized with the render cache disabled")
+	}
+	if second := Render(posts[0]); second.Content != first.Content || second.Hash != first.Hash {
+		t.Errorf("second render differs from the first")
+	}
+}
+
+func TestPlainTextDropsScriptAndStyle(t *testing.T) {
+	tests := []struct {
+		in string
+		want string
+	}{
+		{"<script>alert(1)</script> hi", "hi"},
+		{"Hello <style>p{color:red}</style>world", "Hello world"},
+		{"<SCRIPT type=\"module\">x()</SCRIPT> <b>bold</b> &amp; more", "bold & more"},
+	}
+
+	for _, tt := range tests {
+		if got := plainText(tt.in); got != tt.want {
+			t.Errorf("plainText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
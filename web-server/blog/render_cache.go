@@ -0,0 +1,81 @@
+package blog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+var RenderCacheSize = 1024
+
+var renderCache *lru.Cache[[sha256.Size]byte, renderedContent]
+
+// lazyContent remembers every post rendered with LazyRender set until the
+// next LoadPosts, so a small or disabled renderCache can't make each request
+// parse the markdown again.
+var lazyContent sync.Map
+
+type renderedContent struct {
+	content template.HTML
+	toc template.HTML
+	thumbnail string
+	hash string
+}
+
+// InitRenderCache sizes the render cache from RenderCacheSize.
+func InitRenderCache() {
+	if RenderCacheSize <= 0 {
+		return
+	}
+
+	cache, err := lru.New[[sha256.Size]byte, renderedContent](RenderCacheSize)
+	if err != nil {
+		log.Fatalf("Error creating render cache: %v", err)
+	}
+	renderCache = cache
+}
+
+// ContentHash is a short hex digest of rendered output, used for ETags and
+// to tell when a post has changed.
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:16])
+}
+
+// sourceHash stands in for ContentHash when a post isn't rendered at load:
+// it digests the markdown along with every setting that changes its HTML.
+func sourceHash(body []byte) string {
+	settings := fmt.Sprintf("%s\x00%d\x00%s\x00%t\x00%t\x00", BasePath, Extensions, CodeTheme, MinifyOutput, Sanitize)
+	return ContentHash(append([]byte(settings), body...))
+}
+
+// renderBody renders markdown, reusing an earlier result for identical input.
+func renderBody(body []byte) (rc renderedContent, err error) {
+	defer recoverRender(&err)
+
+	key := sha256.Sum256(body)
+	if renderCache != nil {
+		if rc, ok := renderCache.Get(key); ok {
+			return rc, nil
+		}
+	}
+
+	doc := parseMarkdown(body)
+	content := renderMarkdown(doc)
+	rc = renderedContent{
+		content: template.HTML(content),
+		toc: buildTOC(doc),
+		thumbnail: firstImage(doc),
+		hash: ContentHash(content),
+	}
+
+	if renderCache != nil {
+		renderCache.Add(key, rc)
+	}
+	return rc, nil
+}
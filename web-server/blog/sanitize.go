@@ -0,0 +1,29 @@
+package blog
+
+import (
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+var Sanitize bool
+
+// sanitizer keeps what the renderer itself produces (heading ids and anchors,
+// highlight styles, lazy images, new-tab links) and strips scripts and event
+// handlers.
+var sanitizer = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("id", "class").Globally()
+	p.AllowAttrs("loading", "decoding").OnElements("img")
+	p.AllowAttrs("aria-label").OnElements("a")
+	p.AllowAttrs("target").Matching(regexp.MustCompile(`^_blank$`)).OnElements("a")
+	p.AllowStyles("color", "background-color", "font-weight", "font-style", "text-decoration").OnElements("pre", "code", "span")
+	return p
+}()
+
+func sanitizeHTML(out []byte) []byte {
+	if !Sanitize {
+		return out
+	}
+	return sanitizer.SanitizeBytes(out)
+}
@@ -0,0 +1,76 @@
+package blog
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+type tocEntry struct {
+	ID string
+	Text string
+	Children []tocEntry
+}
+
+func buildTOC(doc ast.Node) template.HTML {
+	var entries []tocEntry
+	count := 0
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering || heading.HeadingID == "" {
+			return ast.GoToNext
+		}
+
+		entry := tocEntry{ID: heading.HeadingID, Text: nodeText(heading)}
+		switch {
+		case heading.Level == 2:
+			entries = append(entries, entry)
+		case heading.Level == 3 && len(entries) > 0:
+			last := &entries[len(entries)-1]
+			last.Children = append(last.Children, entry)
+		case heading.Level == 3:
+			entries = append(entries, entry)
+		default:
+			return ast.SkipChildren
+		}
+		count++
+		return ast.SkipChildren
+	})
+
+	if count < 2 {
+		return ""
+	}
+
+	var b strings.Builder
+	writeTOCList(&b, entries)
+	return template.HTML(b.String())
+}
+
+func writeTOCList(b *strings.Builder, entries []tocEntry) {
+	b.WriteString("<ul>")
+	for _, entry := range entries {
+		b.WriteString(`<li><a href="#`)
+		b.WriteString(template.HTMLEscapeString(entry.ID))
+		b.WriteString(`">`)
+		b.WriteString(template.HTMLEscapeString(entry.Text))
+		b.WriteString("</a>")
+		if len(entry.Children) > 0 {
+			writeTOCList(b, entry.Children)
+		}
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+}
+
+func nodeText(node ast.Node) string {
+	var b strings.Builder
+	ast.WalkFunc(node, func(n ast.Node, entering bool) ast.WalkStatus {
+		if leaf := n.AsLeaf(); entering && leaf != nil {
+			b.Write(leaf.Literal)
+		}
+		return ast.GoToNext
+	})
+	return b.String()
+}
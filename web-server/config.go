@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+	"github.com/alexover1/blog-server/blog"
+)
+
+var configPath string
+
+type Config struct {
+	SiteTitle string `yaml:"site_title"`
+	BaseURL string `yaml:"base_url"`
+	DefaultAuthor string `yaml:"default_author"`
+	WordsPerMinute int `yaml:"wpm"`
+	PreviewLength int `yaml:"preview_length"`
+	CodeTheme string `yaml:"code_theme"`
+	DateFormat string `yaml:"date_format"`
+}
+
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if cfg.WordsPerMinute < 0 {
+		return cfg, fmt.Errorf("%s: wpm must be positive", path)
+	}
+	if cfg.PreviewLength < 0 {
+		return cfg, fmt.Errorf("%s: preview_length must be positive", path)
+	}
+
+	return cfg, nil
+}
+
+// applyConfig copies config values into flags the user didn't set explicitly.
+func applyConfig(cfg Config) {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	if cfg.SiteTitle != "" && !set["site-title"] {
+		siteTitle = cfg.SiteTitle
+	}
+	if cfg.BaseURL != "" && !set["base-url"] {
+		baseURL = cfg.BaseURL
+	}
+	if cfg.DefaultAuthor != "" && !set["default-author"] {
+		blog.DefaultAuthor = cfg.DefaultAuthor
+	}
+	if cfg.WordsPerMinute != 0 && !set["wpm"] {
+		blog.WordsPerMinute = cfg.WordsPerMinute
+	}
+	if cfg.PreviewLength != 0 && !set["preview-len"] {
+		blog.PreviewLength = cfg.PreviewLength
+	}
+	if cfg.CodeTheme != "" && !set["code-theme"] {
+		blog.CodeTheme = cfg.CodeTheme
+	}
+	if cfg.DateFormat != "" && !set["date-format"] {
+		blog.DateFormat = cfg.DateFormat
+	}
+}
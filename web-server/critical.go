@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var criticalCSSPath string
+
+// criticalCSS is inlined into page heads by the "styles" template so the
+// first paint doesn't wait on main.css.
+var criticalCSS template.CSS
+
+func loadCriticalCSS(file string) error {
+	css, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	criticalCSS = template.CSS(bytes.TrimSpace(css))
+	return nil
+}
+
+// serveIndex swaps the homepage's stylesheet link for the "styles" template,
+// since index.html is a static file rather than a template.
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	page, err := os.ReadFile(filepath.Join(publicPath, "index.html"))
+	if err != nil {
+		log.Printf("Error reading index.html: %v", err)
+		internalError(w)
+		return
+	}
+
+	var styles bytes.Buffer
+	if err := templates.ExecuteTemplate(&styles, "styles", nil); err != nil {
+		log.Printf("Error executing template: %v", err)
+		errorPage(w)
+		return
+	}
+
+	link := []byte(`<link rel="stylesheet" href="main.css">`)
+	if bytes.Contains(page, link) {
+		page = bytes.Replace(page, link, styles.Bytes(), 1)
+	} else {
+		page = bytes.Replace(page, []byte("</head>"), append(styles.Bytes(), "</head>"...), 1)
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	writeHTML(w, http.StatusOK, string(page))
+}
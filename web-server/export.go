@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var exportDir string
+
+// exportSite writes the public assets plus every page the server would
+// render into dir, by running requests against handler in memory.
+func exportSite(dir string, handler http.Handler) error {
+	if err := copyDir(publicPath, dir); err != nil {
+		return err
+	}
+
+	pages := map[string]string{
+		"/": "index.html",
+		"/api/posts": "api/posts",
+		"/api/archive": "api/archive",
+		"/api/index.txt": "api/index.txt",
+		"/feed.xml": "feed.xml",
+		"/atom.xml": "atom.xml",
+		"/feed.json": "feed.json",
+		"/feeds.opml": "feeds.opml",
+		"/sitemap.xml": "sitemap.xml",
+		"/robots.txt": "robots.txt",
+	}
+	for _, post := range getPosts() {
+		pages["/api/post/"+post.Slug] = "post/" + post.Slug + ".html"
+		if permalink != "" {
+			file := strings.TrimPrefix(permalinkPath(post), "/")
+			if path.Ext(file) == "" {
+				file = path.Join(file, "index.html")
+			}
+			pages[permalinkPath(post)] = file
+		}
+	}
+
+	for urlPath, file := range pages {
+		if err := exportPage(handler, urlPath, filepath.Join(dir, filepath.FromSlash(file))); err != nil {
+			return err
+		}
+	}
+
+	// The index page fetches posts through these paths, so mirror them
+	// for in-page navigation on a static host.
+	for _, post := range getPosts() {
+		file := filepath.Join(dir, "api", "post", filepath.FromSlash(post.Slug))
+		if err := exportPage(handler, "/api/post/"+post.Slug, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportPage(handler http.Handler, urlPath, file string) error {
+	// Slugs come from file names, so escape spaces, ? and # before they
+	// reach the request line.
+	req, err := http.NewRequest(http.MethodGet, (&url.URL{Path: urlPath}).EscapedPath(), nil)
+	if err != nil {
+		return fmt.Errorf("rendering %s: %w", urlPath, err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return fmt.Errorf("rendering %s: status %d", urlPath, rec.Code)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, rec.Body.Bytes(), 0o644)
+}
+
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, content, 0o644)
+	})
+}
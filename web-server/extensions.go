@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gomarkdown/markdown/parser"
+)
+
+var (
+	mdExt string
+	mdTables bool
+	mdFootnotes bool
+	mdStrikethrough bool
+	mdAutolink bool
+	mdFencedCode bool
+	mdDefinitionLists bool
+	mdHeadingIDs bool
+	mdHardLineBreak bool
+)
+
+// markdownExtensions builds the parser bitmask from the -md-* flags.
+func markdownExtensions() parser.Extensions {
+	ext := parser.CommonExtensions | parser.AutoHeadingIDs | parser.Footnotes
+
+	toggle := func(on bool, bits parser.Extensions) {
+		if on {
+			ext |= bits
+		} else {
+			ext &^= bits
+		}
+	}
+	toggle(mdTables, parser.Tables)
+	toggle(mdFootnotes, parser.Footnotes)
+	toggle(mdStrikethrough, parser.Strikethrough)
+	toggle(mdAutolink, parser.Autolink)
+	toggle(mdFencedCode, parser.FencedCode)
+	toggle(mdDefinitionLists, parser.DefinitionLists)
+	toggle(mdHeadingIDs, parser.HeadingIDs|parser.AutoHeadingIDs)
+	toggle(mdHardLineBreak, parser.HardLineBreak)
+	return ext
+}
+
+// fileExtensions parses -md-ext, adding the leading dot where it was left off.
+func fileExtensions(list string) []string {
+	var exts []string
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	return exts
+}
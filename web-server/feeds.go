@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexover1/blog-server/blog"
+)
+
+const feedLimit = 20
+
+type rssFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title string `xml:"title"`
+	Link string `xml:"link"`
+	Description string `xml:"description"`
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title string `xml:"title"`
+	Link string `xml:"link"`
+	GUID string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Description string `xml:"description"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	ID string `xml:"id"`
+	Title string `xml:"title"`
+	Updated string `xml:"updated"`
+	Author atomAuthor `xml:"author"`
+	Links []atomLink `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID string `xml:"id"`
+	Title string `xml:"title"`
+	Updated string `xml:"updated"`
+	Link atomLink `xml:"link"`
+	Summary string `xml:"summary,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string `xml:"version,attr"`
+	Title string `xml:"head>title"`
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+type opmlOutline struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:"text,attr"`
+	Title string `xml:"title,attr"`
+	XMLURL string `xml:"xmlUrl,attr"`
+	HTMLURL string `xml:"htmlUrl,attr"`
+}
+
+type jsonFeed struct {
+	Version string `json:"version"`
+	Title string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	FeedURL string `json:"feed_url"`
+	Items []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID string `json:"id"`
+	URL string `json:"url"`
+	Title string `json:"title"`
+	DatePublished string `json:"date_published"`
+	ContentHTML string `json:"content_html"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+func siteURL(path string) string {
+	return strings.TrimSuffix(baseURL, "/") + basePath + path
+}
+
+func postURL(post Post) string {
+	return siteURL(permalinkPath(post))
+}
+
+// feedPosts is the newest posts; pinning only affects the listing order.
+func feedPosts() []Post {
+	posts := sortPosts(getPosts(), "date_desc")
+	if len(posts) > feedLimit {
+		posts = posts[:feedLimit]
+	}
+	return posts
+}
+
+// feedUpdated is the newest post date, which feeds report as Last-Modified.
+func feedUpdated(posts []Post) time.Time {
+	var newest time.Time
+	for _, post := range posts {
+		if post.Date.After(newest) {
+			newest = post.Date
+		}
+	}
+	return newest
+}
+
+func handleRSS(w http.ResponseWriter, r *http.Request) {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title: siteTitle,
+			Link: siteURL("/"),
+			Description: siteTitle,
+		},
+	}
+
+	posts := feedPosts()
+	for _, post := range posts {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title: post.Title,
+			Link: postURL(post),
+			GUID: postURL(post),
+			PubDate: post.Date.Format(time.RFC1123Z),
+			Description: post.Preview,
+		})
+	}
+
+	writeXML(w, r, "application/rss+xml", feed, feedUpdated(posts))
+}
+
+func handleAtom(w http.ResponseWriter, r *http.Request) {
+	posts := feedPosts()
+
+	feed := atomFeed{
+		ID: siteURL("/"),
+		Title: siteTitle,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author: atomAuthor{Name: siteTitle},
+		Links: []atomLink{
+			{Rel: "alternate", Href: siteURL("/")},
+			{Rel: "self", Href: siteURL("/atom.xml")},
+		},
+	}
+	if len(posts) > 0 {
+		feed.Updated = feedUpdated(posts).Format(time.RFC3339)
+	}
+
+	for _, post := range posts {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID: postURL(post),
+			Title: post.Title,
+			Updated: post.Date.Format(time.RFC3339),
+			Link: atomLink{Rel: "alternate", Href: postURL(post)},
+			Summary: post.Preview,
+		})
+	}
+
+	writeXML(w, r, "application/atom+xml", feed, feedUpdated(posts))
+}
+
+func handleJSONFeed(w http.ResponseWriter, r *http.Request) {
+	feed := jsonFeed{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title: siteTitle,
+		HomePageURL: siteURL("/"),
+		FeedURL: siteURL("/feed.json"),
+		Items: []jsonFeedItem{},
+	}
+
+	posts := feedPosts()
+	for _, post := range posts {
+		post = blog.Render(post)
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID: postURL(post),
+			URL: postURL(post),
+			Title: post.Title,
+			DatePublished: post.Date.Format(time.RFC3339),
+			ContentHTML: string(post.Content),
+			Tags: post.Tags,
+		})
+	}
+
+	out, err := json.Marshal(feed)
+	if err != nil {
+		log.Printf("Error encoding JSON feed: %v", err)
+		internalError(w)
+		return
+	}
+
+	if checkNotModified(w, r, contentETag(out), feedUpdated(posts)) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+	w.Write(out)
+}
+
+func handleOPML(w http.ResponseWriter, r *http.Request) {
+	doc := opmlDocument{
+		Version: "2.0",
+		Title: siteTitle,
+		Outlines: []opmlOutline{
+			{Type: "rss", Text: siteTitle + " (RSS)", Title: siteTitle, XMLURL: siteURL("/feed.xml"), HTMLURL: siteURL("/")},
+			{Type: "rss", Text: siteTitle + " (Atom)", Title: siteTitle, XMLURL: siteURL("/atom.xml"), HTMLURL: siteURL("/")},
+		},
+	}
+
+	writeXML(w, r, "text/x-opml", doc, time.Time{})
+}
+
+// writeXML serializes v with an ETag from its bytes, answering 304 when the
+// client's copy is current.
+func writeXML(w http.ResponseWriter, r *http.Request, contentType string, v any, modified time.Time) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding %s: %v", contentType, err)
+		internalError(w)
+		return
+	}
+
+	if checkNotModified(w, r, contentETag(out), modified) {
+		return
+	}
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
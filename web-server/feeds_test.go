@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var feedTestPosts = map[string]string{
+	"old.md": "---\ndate: 2024-01-02\n---\n# Old\n\nOlder post.\n",
+	"new.md": "---\ndate: 2024-03-04\n---\n# New\n\nNewer post.\n",
+}
+
+func useBaseURL(t *testing.T, url string) {
+	t.Helper()
+	old := baseURL
+	baseURL = url
+	t.Cleanup(func() { baseURL = old })
+}
+
+func TestAtomFeedParses(t *testing.T) {
+	useBaseURL(t, "https://example.com")
+	loadTestPosts(t, feedTestPosts)
+
+	rec := httptest.NewRecorder()
+	handleAtom(rec, httptest.NewRequest(http.MethodGet, "/atom.xml", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("unmarshaling atom feed: %v", err)
+	}
+
+	if feed.Updated != "2024-03-04T00:00:00Z" {
+		t.Errorf("feed updated %q, want the newest post date", feed.Updated)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(feed.Entries))
+	}
+	entry := feed.Entries[0]
+	if entry.Title != "New" || entry.Updated != "2024-03-04T00:00:00Z" {
+		t.Errorf("first entry %q updated %q, want New at 2024-03-04", entry.Title, entry.Updated)
+	}
+	if entry.Link.Rel != "alternate" || entry.Link.Href != "https://example.com/api/post/new" {
+		t.Errorf("entry link %+v, want alternate to the post permalink", entry.Link)
+	}
+}
+
+func TestOPMLParses(t *testing.T) {
+	useBaseURL(t, "https://example.com")
+	old := siteTitle
+	siteTitle = "Example"
+	t.Cleanup(func() { siteTitle = old })
+
+	rec := httptest.NewRecorder()
+	handleOPML(rec, httptest.NewRequest(http.MethodGet, "/feeds.opml", nil))
+
+	var doc opmlDocument
+	if err := xml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("unmarshaling OPML: %v", err)
+	}
+
+	if doc.Version != "2.0" || doc.Title != "Example" {
+		t.Errorf("got version %q title %q, want 2.0 and Example", doc.Version, doc.Title)
+	}
+	var urls []string
+	for _, outline := range doc.Outlines {
+		urls = append(urls, outline.XMLURL)
+	}
+	if len(urls) != 2 || urls[0] != "https://example.com/feed.xml" || urls[1] != "https://example.com/atom.xml" {
+		t.Errorf("feed URLs %q, want the RSS and Atom feeds", urls)
+	}
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	useBaseURL(t, "https://example.com")
+	loadTestPosts(t, feedTestPosts)
+
+	first := httptest.NewRecorder()
+	handleRSS(first, httptest.NewRequest(http.MethodGet, "/feed.xml", nil))
+	etag := first.Header().Get("ETag")
+	if etag == "" || first.Header().Get("Last-Modified") != "Mon, 04 Mar 2024 00:00:00 GMT" {
+		t.Fatalf("got ETag %q Last-Modified %q, want an ETag and the newest post date", etag, first.Header().Get("Last-Modified"))
+	}
+
+	for header, value := range map[string]string{
+		"If-None-Match": etag,
+		"If-Modified-Since": "Mon, 04 Mar 2024 00:00:00 GMT",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/feed.xml", nil)
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		handleRSS(rec, req)
+
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("%s: status %d with %d bytes, want an empty 304", header, rec.Code, rec.Body.Len())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/feed.xml", nil)
+	req.Header.Set("If-Modified-Since", "Fri, 01 Mar 2024 00:00:00 GMT")
+	rec := httptest.NewRecorder()
+	handleRSS(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("stale If-Modified-Since: status %d, want 200", rec.Code)
+	}
+}
+
+func TestFeedETagIsWeak(t *testing.T) {
+	useBaseURL(t, "https://example.com")
+	loadTestPosts(t, map[string]string{
+		"long.md": "# Long\n\n" + strings.Repeat("Enough words to be worth compressing. ", 50) + "\n",
+	})
+	handler := gzipMiddleware(http.HandlerFunc(handleJSONFeed))
+
+	plain := get(handler, "/feed.json")
+	req := httptest.NewRequest(http.MethodGet, "/feed.json", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	gzipped := httptest.NewRecorder()
+	handler.ServeHTTP(gzipped, req)
+
+	if gzipped.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("feed wasn't compressed")
+	}
+	etag := plain.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) || gzipped.Header().Get("ETag") != etag {
+		t.Errorf("ETags %q and %q, want the same weak tag for both encodings", etag, gzipped.Header().Get("ETag"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/feed.json", nil)
+	req.Header.Set("If-None-Match", strings.TrimPrefix(etag, "W/"))
+	rec := httptest.NewRecorder()
+	handleJSONFeed(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match without W/: status %d, want 304", rec.Code)
+	}
+}
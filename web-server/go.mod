@@ -2,4 +2,22 @@ module github.com/alexover1/blog-server
 
 go 1.23.8
 
-require github.com/gomarkdown/markdown v0.0.0-20250810172220-2e2c11897d1a // indirect
+require github.com/gomarkdown/markdown v0.0.0-20250810172220-2e2c11897d1a
+
+require (
+	github.com/alecthomas/chroma/v2 v2.14.0
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/hashicorp/golang-lru/v2 v2.0.7
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/tdewolff/minify/v2 v2.20.37
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/dlclark/regexp2 v1.11.0 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
+	github.com/tdewolff/parse/v2 v2.7.15 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
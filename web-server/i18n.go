@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alexover1/blog-server/blog"
+)
+
+// languages is the raw -langs flag; blog.Languages holds the parsed list.
+var languages string
+
+type langKey struct{}
+
+// langPrefixKey holds the /{lang} prefix langMiddleware stripped, so
+// redirects can put it back.
+type langPrefixKey struct{}
+
+// langMiddleware picks the request's language from a /{lang}/ path prefix,
+// which it strips, or else from Accept-Language, falling back to the default.
+func langMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang, prefix := "", ""
+		first, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if slices.Contains(blog.Languages, first) {
+			if r.URL.Path == "/"+first {
+				http.Redirect(w, r, basePath+r.URL.Path+"/", http.StatusMovedPermanently)
+				return
+			}
+			lang, prefix = first, "/"+first
+			r.URL.Path = "/" + rest
+			r.URL.RawPath = ""
+		} else {
+			lang = acceptedLang(r.Header.Get("Accept-Language"))
+		}
+
+		w.Header().Set("Content-Language", lang)
+		w.Header().Add("Vary", "Accept-Language")
+		ctx := context.WithValue(r.Context(), langKey{}, lang)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, langPrefixKey{}, prefix)))
+	})
+}
+
+func acceptedLang(header string) string {
+	type tag struct {
+		name string
+		q float64
+	}
+
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if name != "" && q > 0 {
+			tags = append(tags, tag{strings.ToLower(name), q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, t := range tags {
+		primary, _, _ := strings.Cut(t.name, "-")
+		for _, name := range []string{t.name, primary} {
+			if slices.Contains(blog.Languages, name) {
+				return name
+			}
+		}
+	}
+	return blog.DefaultLang
+}
+
+func requestLang(r *http.Request) string {
+	lang, _ := r.Context().Value(langKey{}).(string)
+	return lang
+}
+
+func langPrefix(r *http.Request) string {
+	prefix, _ := r.Context().Value(langPrefixKey{}).(string)
+	return prefix
+}
+
+// langPosts returns the published posts in the request's language, or all
+// of them when the site isn't multilingual.
+func langPosts(r *http.Request) []Post {
+	return postsInLang(requestLang(r))
+}
+
+func postsInLang(lang string) []Post {
+	posts := getPosts()
+	if len(blog.Languages) == 0 || lang == "" {
+		return posts
+	}
+
+	var filtered []Post
+	for _, post := range posts {
+		if post.Lang == lang {
+			filtered = append(filtered, post)
+		}
+	}
+	return filtered
+}
+
+func withTranslations(post Post, posts []Post) Post {
+	if len(blog.Languages) == 0 {
+		return post
+	}
+
+	key := blog.TranslationKey(post)
+	for _, other := range posts {
+		if other.Slug != post.Slug && other.Lang != post.Lang && blog.TranslationKey(other) == key {
+			post.Translations = append(post.Translations, other)
+		}
+	}
+	return post
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexover1/blog-server/blog"
+)
+
+type postSummary struct {
+	Slug string `json:"slug"`
+	Title string `json:"title"`
+	Category string `json:"category,omitempty"`
+	Author string `json:"author,omitempty"`
+	Date string `json:"date"`
+	Preview string `json:"preview"`
+	Tags []string `json:"tags"`
+	Pinned bool `json:"pinned,omitempty"`
+	Weight int `json:"weight,omitempty"`
+	Lang string `json:"lang,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+type recentPost struct {
+	Slug string `json:"slug"`
+	Title string `json:"title"`
+	Date string `json:"date"`
+}
+
+type postDetail struct {
+	postSummary
+	Canonical string `json:"canonical"`
+	Content string `json:"content"`
+}
+
+// bundleCache holds the marshaled /api/bundle.json payload until the next
+// reload. Builds hold the lock, so a reload waits for one in flight.
+var bundleCache struct {
+	sync.Mutex
+	data []byte
+}
+
+type tagCount struct {
+	Tag string `json:"tag"`
+	Count int `json:"count"`
+}
+
+func countTags(posts []Post) []tagCount {
+	index := map[string]int{}
+	var counts []tagCount
+	for _, post := range posts {
+		for _, tag := range post.Tags {
+			key := strings.ToLower(tag)
+			i, ok := index[key]
+			if !ok {
+				i = len(counts)
+				index[key] = i
+				counts = append(counts, tagCount{Tag: tag})
+			}
+			counts[i].Count++
+		}
+	}
+
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return strings.ToLower(counts[i].Tag) < strings.ToLower(counts[j].Tag)
+	})
+	return counts
+}
+
+func newPostSummary(post Post) postSummary {
+	tags := post.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return postSummary{
+		Slug: post.Slug,
+		Title: post.Title,
+		Category: post.Category,
+		Author: post.Author,
+		Date: post.Date.Format(time.RFC3339),
+		Preview: post.Preview,
+		Tags: tags,
+		Pinned: post.Pinned,
+		Weight: post.Weight,
+		Lang: post.Lang,
+		Hash: post.Hash,
+	}
+}
+
+func newPostDetail(post Post) postDetail {
+	return postDetail{
+		postSummary: newPostSummary(post),
+		Canonical: post.Canonical,
+		Content: string(post.Content),
+	}
+}
+
+// postBundle returns every published post with its rendered content as one
+// JSON array. It grows with the blog, so clients should expect a large
+// (though well compressed) response.
+func postBundle() ([]byte, error) {
+	bundleCache.Lock()
+	defer bundleCache.Unlock()
+
+	if bundleCache.data != nil {
+		return bundleCache.data, nil
+	}
+
+	posts := getPosts()
+	details := make([]postDetail, 0, len(posts))
+	for _, post := range posts {
+		details = append(details, newPostDetail(blog.Render(post)))
+	}
+
+	data, err := json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+	bundleCache.data = data
+	return data, nil
+}
+
+func resetBundle() {
+	bundleCache.Lock()
+	bundleCache.data = nil
+	bundleCache.Unlock()
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+		internalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
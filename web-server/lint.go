@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/alexover1/blog-server/blog"
+)
+
+var lintOnly bool
+
+func lintPosts(posts []Post) {
+	files := 0
+	total := 0
+	for _, post := range posts {
+		issues := blog.Lint(post)
+		if len(issues) == 0 {
+			continue
+		}
+
+		fmt.Printf("%s:\n", post.Path)
+		for _, issue := range issues {
+			fmt.Printf("  %s\n", issue)
+		}
+		files++
+		total += len(issues)
+	}
+	fmt.Printf("Checked %d posts: %d issues in %d files\n", len(posts), total, files)
+}
@@ -1,162 +1,1075 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
 	"fmt"
 	"net/http"
+	"net/url"
 	"html/template"
-	"io/ioutil"
+	"io"
+	"path"
 	"path/filepath"
 	"log"
+	"regexp"
 	"strings"
 	"strconv"
 	"sort"
+	"slices"
 	"time"
 	"flag"
+	"net"
+	"sync"
+	"sync/atomic"
 
-	"github.com/gomarkdown/markdown"
-	"github.com/gomarkdown/markdown/html"
-	"github.com/gomarkdown/markdown/parser"
+	"github.com/alexover1/blog-server/blog"
 )
 
 var (
 	docsPath string
+	templatesPath string
+	publicPath string
+	staticMaxAge time.Duration
 	port int
+	addr string
+	tlsCert string
+	tlsKey string
+	redirectHTTP string
+	siteTitle string
+	baseURL string
+	basePath string
+	showDrafts bool
+	previewEndpoint bool
+	watch bool
+	defaultSort string
+	readTimeout time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout time.Duration
+	idleTimeout time.Duration
+	maxHeaderBytes int
+	maxBodyBytes int64
 )
 
+type Post = blog.Post
+
+var templates *template.Template
+
+var postsLoaded atomic.Bool
+
+// postCache is swapped whole on reload; the slices it hands out are shared
+// between requests and must be treated as read-only.
+var postCache struct {
+	sync.RWMutex
+	all []Post
+	posts []Post
+}
+
+func getPosts() []Post {
+	postCache.RLock()
+	defer postCache.RUnlock()
+	return postCache.posts
+}
+
+func getAllPosts() []Post {
+	postCache.RLock()
+	defer postCache.RUnlock()
+	return postCache.all
+}
+
+func reloadPosts() {
+	all := blog.LoadPosts(docsPath)
+	for i := range all {
+		all[i].URL = postURL(all[i])
+		if all[i].Canonical == "" {
+			all[i].Canonical = all[i].URL
+		}
+	}
+
+	var published []Post
+	for _, post := range all {
+		if !post.Draft {
+			published = append(published, post)
+		}
+	}
+
+	postCache.Lock()
+	postCache.all = all
+	postCache.posts = published
+	postCache.Unlock()
+	resetBundle()
+	postsLoaded.Store(true)
+	blog.LogMinifySavings()
+	log.Printf("Loaded %d posts (%d drafts)", len(all), len(all)-len(published))
+
+	if previewSecret != "" {
+		for _, post := range all {
+			if post.Draft {
+				log.Printf("Preview link for draft %s: %s?token=%s", post.Slug, post.URL, previewToken(post.Slug))
+			}
+		}
+	}
+}
+
 func main() {
+	flag.StringVar(&configPath, "config", "", "path to a YAML site config file; flags override its values")
 	flag.StringVar(&docsPath, "docs", "docs", "path to directory containing markdown (.md) files")
-	flag.IntVar(&port, "port", 8000, "port to serve the http files")
+	flag.StringVar(&languages, "langs", "", "comma-separated languages with their own docs subdirectory, e.g. en,es (empty disables i18n)")
+	flag.StringVar(&blog.DefaultLang, "default-lang", "en", "language for posts outside a language directory and for visitors with no match")
+	flag.StringVar(&blog.SnippetsDir, "snippets", "snippets", "directory that {{< include \"file.md\" >}} shortcodes read from")
+	flag.StringVar(&mdExt, "md-ext", ".md,.markdown", "comma-separated file extensions loaded as posts, e.g. .md,.markdown,.mdx")
+	flag.StringVar(&templatesPath, "templates", "templates", "path to directory containing html templates")
+	flag.StringVar(&criticalCSSPath, "critical-css", "", "CSS file inlined into page heads, with main.css loaded asynchronously")
+	flag.StringVar(&publicPath, "public", "public", "path to directory of static files to serve")
+	flag.DurationVar(&staticMaxAge, "static-max-age", time.Hour, "Cache-Control max-age for static assets")
+	flag.IntVar(&port, "port", 8000, "port to serve the http files (ignored when -addr is set)")
+	flag.StringVar(&addr, "addr", ":8000", "address to listen on")
+	flag.StringVar(&permalink, "permalink", "", "post URL pattern using :year, :month, :day and :slug, e.g. /:year/:month/:slug (default /api/post/:slug)")
+	flag.StringVar(&basePath, "base-path", "", "URL path prefix the site is served under, e.g. /blog")
+	flag.StringVar(&blog.DefaultAuthor, "default-author", "", "author for posts that don't set one in front matter")
+	flag.StringVar(&blog.SiteImage, "site-image", "", "default social preview image URL for posts without an image")
+	flag.StringVar(&blog.DateFormat, "date-format", "Jan 2, 2006", "Go time layout used to display post dates")
+	flag.IntVar(&blog.PreviewLength, "preview-len", 150, "maximum length in characters of generated post previews")
+	flag.IntVar(&blog.WordsPerMinute, "wpm", 200, "reading speed in words per minute used for reading time estimates")
+	flag.StringVar(&defaultSort, "sort", "", "default order for post listings when ?sort= isn't given: date_desc, date_asc, title_asc, title_desc or weight (empty keeps pinned posts first, then newest)")
+	flag.BoolVar(&showDrafts, "drafts", false, "serve draft posts at their direct URL for local preview")
+	flag.StringVar(&previewSecret, "preview-secret", "", "secret for signing per-draft preview links (?token=...); links are logged at load")
+	flag.StringVar(&statsFile, "stats-file", "", "JSON file post view counts are saved to and restored from (empty keeps them in memory only)")
+	flag.StringVar(&exportDir, "export", "", "write the site as static files to this directory and exit instead of serving")
+	flag.BoolVar(&lintOnly, "lint", false, "report images without alt text and skipped heading levels, then exit")
+	flag.BoolVar(&watch, "watch", false, "reload posts when files in the docs directory change")
+	flag.StringVar(&trailingSlash, "trailing-slash", "redirect", "how to handle a trailing slash on post, tag, author and series URLs: redirect or strip")
+	flag.StringVar(&logFormat, "log-format", "text", "request log format: text or json")
+	flag.Float64Var(&rateLimit, "rate", 0, "per-client request rate limit in requests per second (0 disables)")
+	flag.IntVar(&rateBurst, "burst", 20, "maximum burst size for the per-client rate limit")
+	flag.StringVar(&corsOrigins, "cors-origins", "", "comma-separated origins allowed to call /api/ from the browser, or * for any")
+	flag.BoolVar(&trustProxy, "trust-proxy", false, "use X-Forwarded-For to identify clients when behind a reverse proxy")
+	flag.StringVar(&tlsCert, "tls-cert", "", "path to a TLS certificate file; enables HTTPS together with -tls-key")
+	flag.StringVar(&tlsKey, "tls-key", "", "path to a TLS private key file; enables HTTPS together with -tls-cert")
+	flag.StringVar(&redirectHTTP, "redirect-http", "", "address of an extra plain HTTP listener that redirects to HTTPS, e.g. :80")
+	flag.DurationVar(&readTimeout, "read-timeout", 15*time.Second, "maximum time to read a whole request, including the body")
+	flag.DurationVar(&readHeaderTimeout, "read-header-timeout", 5*time.Second, "maximum time to read request headers")
+	flag.DurationVar(&writeTimeout, "write-timeout", 30*time.Second, "maximum time to write a response")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 2*time.Minute, "how long keep-alive connections may sit idle")
+	flag.IntVar(&maxHeaderBytes, "max-header-bytes", 64<<10, "maximum size of request headers in bytes")
+	flag.Int64Var(&maxBodyBytes, "max-body", 1<<20, "maximum size of request bodies in bytes")
+	flag.BoolVar(&noIndex, "no-index", false, "ask crawlers not to index the site via robots.txt (for staging)")
+	flag.BoolVar(&previewEndpoint, "preview", false, "enable POST /api/render for live markdown previews")
+	flag.BoolVar(&blog.LazyRender, "lazy-render", false, "render post HTML on first request instead of at load time, for very large blogs")
+	flag.IntVar(&blog.RenderCacheSize, "render-cache-size", 1024, "number of rendered posts to keep in the LRU render cache (0 disables)")
+	flag.BoolVar(&blog.Sanitize, "sanitize", false, "strip scripts, event handlers and other unsafe HTML from rendered posts and ignore css/js front matter")
+	flag.BoolVar(&blog.MinifyOutput, "minify", false, "minify rendered HTML")
+	flag.BoolVar(&mdTables, "md-tables", true, "enable markdown tables")
+	flag.BoolVar(&mdFootnotes, "md-footnotes", true, "enable markdown footnotes")
+	flag.BoolVar(&mdStrikethrough, "md-strikethrough", true, "enable ~~strikethrough~~")
+	flag.BoolVar(&mdAutolink, "md-autolink", true, "turn bare URLs into links")
+	flag.BoolVar(&mdFencedCode, "md-fenced-code", true, "enable fenced code blocks")
+	flag.BoolVar(&mdDefinitionLists, "md-definition-lists", true, "enable definition lists")
+	flag.BoolVar(&mdHeadingIDs, "md-heading-ids", true, "generate id attributes for headings")
+	flag.BoolVar(&mdHardLineBreak, "md-hard-line-break", false, "treat every newline in a paragraph as a line break")
+	flag.StringVar(&blog.CodeTheme, "code-theme", "github", "chroma style used to highlight fenced code blocks")
+	flag.StringVar(&siteTitle, "site-title", "My Blog", "site title used in feeds")
+	flag.StringVar(&baseURL, "base-url", "http://localhost:8000", "public base URL of the site, used for absolute links")
 	flag.Parse()
 
-	templates, err := template.ParseGlob("templates/*.html")
+	if configPath != "" {
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			log.Fatalf("Error loading config: %v", err)
+		}
+		applyConfig(cfg)
+	}
+
+	basePath = strings.TrimSuffix(basePath, "/")
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	blog.BasePath = basePath
+	blog.Extensions = markdownExtensions()
+	blog.FileExtensions = fileExtensions(mdExt)
+	for _, lang := range strings.Split(languages, ",") {
+		if lang = strings.ToLower(strings.TrimSpace(lang)); lang != "" {
+			blog.Languages = append(blog.Languages, lang)
+		}
+	}
+
+	if blog.PreviewLength < 1 {
+		log.Fatalf("Invalid -preview-len %d: must be at least 1", blog.PreviewLength)
+	}
+
+	if permalink != "" && (!strings.HasPrefix(permalink, "/") || !strings.Contains(permalink, ":slug")) {
+		log.Fatalf("Invalid -permalink %q: must start with / and contain :slug", permalink)
+	}
+
+	switch defaultSort {
+	case "", "date_desc", "date_asc", "title_asc", "title_desc", "weight":
+	default:
+		log.Fatalf("Invalid -sort %q: must be date_desc, date_asc, title_asc, title_desc or weight", defaultSort)
+	}
+
+	if trailingSlash != "redirect" && trailingSlash != "strip" {
+		log.Fatalf("Invalid -trailing-slash %q: must be redirect or strip", trailingSlash)
+	}
+
+	if logFormat != "text" && logFormat != "json" {
+		log.Fatalf("Invalid -log-format %q: must be text or json", logFormat)
+	}
+
+	useTLS := tlsCert != "" || tlsKey != ""
+	if useTLS && (tlsCert == "" || tlsKey == "") {
+		log.Fatalf("Both -tls-cert and -tls-key must be set to enable TLS")
+	}
+	if redirectHTTP != "" && !useTLS {
+		log.Fatalf("-redirect-http requires -tls-cert and -tls-key")
+	}
+
+	if info, err := os.Stat(docsPath); os.IsNotExist(err) {
+		log.Fatalf("Docs directory %q does not exist; point -docs at the folder containing your markdown posts", docsPath)
+	} else if err != nil {
+		log.Fatalf("Error reading docs directory: %v", err)
+	} else if !info.IsDir() {
+		log.Fatalf("-docs %q is a file, not a directory", docsPath)
+	}
+
+	addrSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "addr" {
+			addrSet = true
+		}
+	})
+	if !addrSet {
+		addr = fmt.Sprintf(":%v", port)
+	}
+
+	log.Printf("blog-server %s (commit %s, built %s)", version, commit, buildTime)
+
+	var err error
+	templates, err = template.New("").Funcs(templateFuncs).ParseGlob(filepath.Join(templatesPath, "*.html"))
 	if err != nil {
 		log.Fatalf("Error loading templates: %v", err)
 	}
 
-	fileserver := http.FileServer(http.Dir("public"))
+	if criticalCSSPath != "" {
+		if err := loadCriticalCSS(criticalCSSPath); err != nil {
+			log.Fatalf("Error loading critical CSS: %v", err)
+		}
+	}
+
+	blog.InitRenderCache()
+	reloadPosts()
+
+	if lintOnly {
+		lintPosts(getAllPosts())
+		return
+	}
+
+	if statsFile != "" && exportDir == "" {
+		if err := loadStats(statsFile); err != nil {
+			log.Fatalf("Error loading stats: %v", err)
+		}
+		flushStatsPeriodically(statsFile)
+	}
+
+	if watch && exportDir == "" {
+		if err := watchPosts(docsPath); err != nil {
+			log.Fatalf("Error watching docs directory: %v", err)
+		}
+	}
+
+	mux := newMux()
+
+	if exportDir != "" {
+		if err := exportSite(exportDir, mux); err != nil {
+			log.Fatalf("Error exporting site: %v", err)
+		}
+		log.Printf("Exported site to %s", exportDir)
+		return
+	}
+
+	var handler http.Handler = gzipMiddleware(mux)
+	if corsOrigins != "" {
+		var origins []string
+		for _, origin := range strings.Split(corsOrigins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				origins = append(origins, strings.TrimSuffix(origin, "/"))
+			}
+		}
+		handler = corsMiddleware(handler, origins)
+	}
+	if len(blog.Languages) > 0 {
+		handler = langMiddleware(handler)
+	}
+	if basePath != "" {
+		handler = basePathMiddleware(handler, basePath)
+	}
+	if rateLimit > 0 {
+		handler = rateLimitMiddleware(handler, newRateLimiter(rateLimit, rateBurst))
+	}
+
+	server := newServer(addr, requestIDMiddleware(loggingMiddleware(handler)))
+
+	var redirectServer *http.Server
+	if redirectHTTP != "" {
+		redirectServer = newServer(redirectHTTP, httpsRedirect(addr))
+		go func() {
+			log.Printf("Redirecting HTTP on %v to HTTPS", redirectHTTP)
+			if err := redirectServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+
+		log.Printf("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if redirectServer != nil {
+			redirectServer.Shutdown(ctx)
+		}
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down: %v", err)
+		}
+		if statsFile != "" {
+			if err := saveStats(statsFile); err != nil {
+				log.Printf("Error saving stats: %v", err)
+			}
+		}
+	}()
 
-	http.Handle("/", fileserver)
-	http.HandleFunc("/api/posts", func(w http.ResponseWriter, r *http.Request) {
-		posts := loadPosts()
+	if useTLS {
+		log.Printf("Listening on %v (TLS)", addr)
+		err = server.ListenAndServeTLS(tlsCert, tlsKey)
+	} else {
+		log.Printf("Listening on %v", addr)
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+	log.Printf("Server stopped")
+}
+
+// newMux registers every route; main wraps it in middleware.
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	fileserver := http.FileServer(http.Dir(publicPath))
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if post := findPermalink(r.URL.Path); post != nil && draftVisible(r, *post) {
+			if post.Draft {
+				w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+			}
+			renderPost(w, r, *post)
+			return
+		}
+		if r.URL.Path == "/" && criticalCSS != "" {
+			serveIndex(w, r)
+			return
+		}
+		if _, err := os.Stat(filepath.Join(publicPath, filepath.FromSlash(path.Clean(r.URL.Path)))); os.IsNotExist(err) {
+			notFound(w, r)
+			return
+		}
+		setStaticCacheHeaders(w, r.URL.Path)
+		fileserver.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/api/posts", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		posts := langPosts(r)
 
 		if len(posts) == 0 {
 			fmt.Fprint(w, "<p>No posts available yet.</p>")
 			return
 		}
 
-		limit := len(posts)
-		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-			if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-				if parsedLimit < limit {
-					limit = parsedLimit
-				}
+		query := r.URL.Query()
+		posts, err := filterByDate(query, sortPosts(posts, listOrder(query)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		posts, err = paginatePosts(w, query, posts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		renderCards(w, posts)
+	}))
+	mux.HandleFunc("/api/posts.json", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		posts, err := filterByDate(query, sortPosts(langPosts(r), listOrder(query)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		posts, err = paginatePosts(w, query, posts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		summaries := make([]postSummary, 0, len(posts))
+		for _, post := range posts {
+			summaries = append(summaries, newPostSummary(post))
+		}
+
+		writeJSON(w, summaries)
+	}))
+	mux.HandleFunc("/api/recent", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		posts := sortPosts(langPosts(r), "date_desc")
+		posts = posts[:min(len(posts), queryInt(r.URL.Query().Get("n"), 5), 20)]
+
+		recent := make([]recentPost, 0, len(posts))
+		for _, post := range posts {
+			recent = append(recent, recentPost{Slug: post.Slug, Title: post.Title, Date: post.Date.Format(time.RFC3339)})
+		}
+
+		// Embedded on other sites, so any origin may read it.
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		writeJSON(w, recent)
+	}))
+	mux.HandleFunc("/api/index.txt", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		for _, post := range sortPosts(langPosts(r), "date_desc") {
+			// Tabs and newlines in a title would break the columns.
+			fmt.Fprintf(&b, "%s\t%s\t%s\n", post.Slug, post.Date.Format(time.RFC3339), strings.Join(strings.Fields(post.Title), " "))
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, b.String())
+	}))
+	mux.HandleFunc("/api/stats", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, statsSnapshot())
+	}))
+	mux.HandleFunc("/api/search", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			http.Error(w, "missing search query", http.StatusBadRequest)
+			return
+		}
+
+		results := searchPosts(langPosts(r), q)
+		if len(results) == 0 {
+			fmt.Fprint(w, "<p>No results.</p>")
+			return
+		}
+
+		renderCards(w, results)
+	}))
+	mux.HandleFunc("/api/archive", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		renderTemplate(w, "archive.html", buildArchive(langPosts(r)))
+	}))
+	mux.HandleFunc("/api/bundle.json", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		data, err := postBundle()
+		if err != nil {
+			log.Printf("Error encoding JSON: %v", err)
+			internalError(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	mux.HandleFunc("/api/archive.json", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, buildArchive(langPosts(r)))
+	}))
+	mux.HandleFunc("/api/tags", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		counts := countTags(langPosts(r))
+		if counts == nil {
+			counts = []tagCount{}
+		}
+		writeJSON(w, counts)
+	}))
+	mux.HandleFunc("/api/tag/", getOnly(trimTrailingSlash("/api/tag/", func(w http.ResponseWriter, r *http.Request) {
+		tag := strings.TrimPrefix(r.URL.Path, "/api/tag/")
+
+		var tagged []Post
+		for _, post := range langPosts(r) {
+			if hasTag(post, tag) {
+				tagged = append(tagged, post)
 			}
 		}
 
-		var html strings.Builder
-		for i := 0; i < limit; i++ {
-			err := templates.ExecuteTemplate(&html, "post-card.html", posts[i])
-			if err != nil {
-				log.Printf("Error executing template: %v", err)
+		if len(tagged) == 0 {
+			notFound(w, r)
+			return
+		}
+
+		renderCards(w, tagged)
+	})))
+	mux.HandleFunc("/api/author/", getOnly(trimTrailingSlash("/api/author/", func(w http.ResponseWriter, r *http.Request) {
+		name := nameSlug(strings.TrimPrefix(r.URL.Path, "/api/author/"))
+
+		var authored []Post
+		for _, post := range langPosts(r) {
+			if post.Author != "" && nameSlug(post.Author) == name {
+				authored = append(authored, post)
 			}
 		}
 
-		w.Header().Set("Content-Type", "text/html")
-		fmt.Fprint(w, html.String())
-	})
-	http.HandleFunc("/api/post/", func(w http.ResponseWriter, r *http.Request) {
-		slug := strings.TrimPrefix(r.URL.Path, "/api/post/")
+		if len(authored) == 0 {
+			notFound(w, r)
+			return
+		}
+
+		renderCards(w, authored)
+	})))
+	mux.HandleFunc("/api/series/", getOnly(trimTrailingSlash("/api/series/", func(w http.ResponseWriter, r *http.Request) {
+		parts := seriesPosts(strings.TrimPrefix(r.URL.Path, "/api/series/"), langPosts(r))
+		if len(parts) == 0 {
+			notFound(w, r)
+			return
+		}
+
+		renderCards(w, parts)
+	})))
+	mux.HandleFunc("/api/post/", getOnly(trimTrailingSlash("/api/post/", func(w http.ResponseWriter, r *http.Request) {
+		slug, ok := normalizeSlug(strings.TrimPrefix(r.URL.Path, "/api/post/"))
+		if !ok {
+			notFound(w, r)
+			return
+		}
 
-		posts := loadPosts()
+		slug, asJSON := strings.CutSuffix(slug, ".json")
+		slug, asMarkdown := strings.CutSuffix(slug, ".md")
 
-		var post *Post
-		for i := range posts {
-			if posts[i].Slug == slug {
-				post = &posts[i]
-				break
+		post := findPost(slug)
+		if post == nil || !draftVisible(r, *post) {
+			notFound(w, r)
+			return
+		}
+		if post.Draft {
+			w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+		}
+
+		if asJSON {
+			writeJSON(w, newPostDetail(*post))
+			return
+		}
+		if asMarkdown {
+			if checkNotModified(w, r, contentETag([]byte(post.Markdown)), post.Date) {
+				return
 			}
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			fmt.Fprint(w, post.Markdown)
+			return
 		}
 
-		if post == nil {
-			http.NotFound(w, r)
+		renderPost(w, r, *post)
+	})))
+
+	if previewEndpoint {
+		mux.HandleFunc("/api/render", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			md, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+			if err != nil {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			_, body := blog.ParseFrontMatter(md)
+			body = blog.ExpandIncludes(body)
+			out, err := blog.MdToHtml(body)
+			if err != nil {
+				log.Printf("Error rendering preview: %v", err)
+				http.Error(w, "could not render markdown", http.StatusUnprocessableEntity)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.Write(out)
+		})
+	}
+
+	mux.HandleFunc("/version", getOnly(handleVersion))
+	mux.HandleFunc("/healthz", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, "ok")
+	}))
+	mux.HandleFunc("/readyz", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !postsLoaded.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "not ready")
 			return
 		}
+		fmt.Fprint(w, "ok")
+	}))
 
-		w.Header().Set("Content-Type", "text/html")
-		err := templates.ExecuteTemplate(w, "post.html", post)
-		if err != nil {
-			log.Printf("Error executing template: %v", err)
+	mux.HandleFunc("/feed.xml", getOnly(handleRSS))
+	mux.HandleFunc("/atom.xml", getOnly(handleAtom))
+	mux.HandleFunc("/feed.json", getOnly(handleJSONFeed))
+	mux.HandleFunc("/feeds.opml", getOnly(handleOPML))
+	mux.HandleFunc("/sitemap.xml", getOnly(handleSitemap))
+	mux.HandleFunc("/robots.txt", getOnly(handleRobots))
+	return mux
+}
+
+// newServer applies the timeout and size limits so slow or oversized
+// requests can't hold connections open indefinitely.
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr: addr,
+		Handler: handler,
+		ReadTimeout: readTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout: writeTimeout,
+		IdleTimeout: idleTimeout,
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+}
+
+func httpsRedirect(tlsAddr string) http.Handler {
+	_, tlsPort, _ := net.SplitHostPort(tlsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
 		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
 	})
+}
 
-	log.Printf("Listening on port :%v", port)
-	http.ListenAndServe(fmt.Sprintf(":%v", port), nil)
+func normalizeSlug(slug string) (string, bool) {
+	slug = strings.ToLower(strings.TrimSuffix(slug, "/"))
+	if slug == "" || strings.ContainsAny(slug, "\\\x00") || strings.HasPrefix(slug, "/") {
+		return "", false
+	}
+
+	for _, segment := range strings.Split(slug, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", false
+		}
+	}
+	return slug, true
 }
 
-type Post struct {
-	Slug string
-	Title string
-	Content template.HTML
-	Date time.Time
-	Preview string
+func renderPost(w http.ResponseWriter, r *http.Request, post Post) {
+	if r.Method == http.MethodGet {
+		recordView(post.Slug)
+	}
+
+	siblings := postsInLang(post.Lang)
+	page := withNeighbours(post, sortPosts(siblings, "date_desc"))
+	page.Related = relatedPosts(post, siblings, 3)
+	page = withSeries(page, siblings)
+	page = withTranslations(page, getPosts())
+
+	var html strings.Builder
+	if err := templates.ExecuteTemplate(&html, "post.html", page); err != nil {
+		log.Printf("Error executing template post.html: %v", err)
+		errorPage(w)
+		return
+	}
+
+	// The page links to its neighbours and related posts too, so tag the
+	// whole output rather than just the body, and date it by the newest post.
+	modified := post.Date
+	if newest := feedUpdated(siblings); newest.After(modified) {
+		modified = newest
+	}
+	if checkNotModified(w, r, contentETag([]byte(html.String())), modified) {
+		return
+	}
+	writeHTML(w, http.StatusOK, html.String())
 }
 
-func loadPosts() []Post {
-	var posts []Post
+func findPost(slug string) *Post {
+	posts := getAllPosts()
+	for i := range posts {
+		if strings.EqualFold(posts[i].Slug, slug) {
+			post := blog.Render(posts[i])
+			return &post
+		}
+	}
+	return nil
+}
 
-	files, err := ioutil.ReadDir(docsPath)
-	if err != nil {
-		log.Printf("Error reading docs directory: %v", err)
+// listOrder is the ?sort= query value, falling back to -sort.
+func listOrder(query url.Values) string {
+	if order := query.Get("sort"); order != "" {
+		return order
+	}
+	return defaultSort
+}
+
+func sortPosts(posts []Post, order string) []Post {
+	var less func(a, b Post) bool
+	switch order {
+	case "date_desc":
+		less = func(a, b Post) bool { return a.Date.After(b.Date) }
+	case "date_asc":
+		less = func(a, b Post) bool { return a.Date.Before(b.Date) }
+	case "title_asc":
+		less = func(a, b Post) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	case "title_desc":
+		less = func(a, b Post) bool { return strings.ToLower(a.Title) > strings.ToLower(b.Title) }
+	case "weight":
+		// Like series_order, a weight of 0 means unset and sorts last.
+		less = func(a, b Post) bool {
+			if (a.Weight > 0) != (b.Weight > 0) {
+				return a.Weight > 0
+			}
+			if a.Weight != b.Weight {
+				return a.Weight < b.Weight
+			}
+			return a.Date.After(b.Date)
+		}
+	default:
 		return posts
 	}
 
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".md" {
-			content, err := ioutil.ReadFile(filepath.Join("docs", file.Name()))
-			if err != nil {
-				log.Printf("Error reading file %s: %v", file.Name(), err)
-				continue
+	sorted := make([]Post, len(posts))
+	copy(sorted, posts)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+	return sorted
+}
+
+// filterByDate keeps posts dated within the inclusive from/to range. A bare
+// date for "to" covers that whole day.
+func filterByDate(query url.Values, posts []Post) ([]Post, error) {
+	if !query.Has("from") && !query.Has("to") {
+		return posts, nil
+	}
+
+	var from, to time.Time
+	if v := query.Get("from"); v != "" {
+		t, ok := blog.ParseDate(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid from date %q: use RFC3339 or YYYY-MM-DD", v)
+		}
+		from = t
+	}
+	if v := query.Get("to"); v != "" {
+		t, ok := blog.ParseDate(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid to date %q: use RFC3339 or YYYY-MM-DD", v)
+		}
+		if _, err := time.Parse("2006-01-02", v); err == nil {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		to = t
+	}
+
+	var filtered []Post
+	for _, post := range posts {
+		if !from.IsZero() && post.Date.Before(from) {
+			continue
+		}
+		if !to.IsZero() && post.Date.After(to) {
+			continue
+		}
+		filtered = append(filtered, post)
+	}
+	return filtered, nil
+}
+
+func paginatePosts(w http.ResponseWriter, query url.Values, posts []Post) ([]Post, error) {
+	if query.Has("before") {
+		return postsBefore(w, query, posts)
+	}
+
+	if query.Has("page") || query.Has("per_page") {
+		page := queryInt(query.Get("page"), 1)
+		perPage := queryInt(query.Get("per_page"), 10)
+
+		totalPages := (len(posts) + perPage - 1) / perPage
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(posts)))
+		w.Header().Set("X-Total-Pages", strconv.Itoa(totalPages))
+
+		start := (page - 1) * perPage
+		if start >= len(posts) {
+			return nil, nil
+		}
+		end := min(start+perPage, len(posts))
+
+		return posts[start:end], nil
+	}
+
+	limit := len(posts)
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			if parsedLimit < limit {
+				limit = parsedLimit
 			}
+		}
+	}
 
-			htmlContent := mdToHtml(content)
-			slug := strings.TrimSuffix(file.Name(), ".md")
+	return posts[:limit], nil
+}
 
-			lines := strings.Split(string(content), "\n")
-			title := strings.TrimPrefix(lines[0], "# ")
-			preview := ""
-			if len(lines) > 2 {
-				preview = strings.TrimSpace(lines[2])
-				if len(preview) > 150 {
-					preview = preview[:150] + "..."
-				}
+// postsBefore returns the batch after a cursor, which is either a post slug
+// or a date, and sets X-Next-Cursor when more posts remain. Unlike page
+// numbers it doesn't shift when new posts are published. Batches are always
+// newest first, whatever the sort, since a cursor only makes sense by date.
+func postsBefore(w http.ResponseWriter, query url.Values, posts []Post) ([]Post, error) {
+	posts = sortPosts(posts, "date_desc")
+	cursor := query.Get("before")
+	var rest []Post
+	if date, ok := blog.ParseDate(cursor); ok {
+		for _, post := range posts {
+			if post.Date.Before(date) {
+				rest = append(rest, post)
 			}
+		}
+	} else {
+		i := slices.IndexFunc(posts, func(post Post) bool { return strings.EqualFold(post.Slug, cursor) })
+		if i == -1 {
+			return nil, fmt.Errorf("invalid before cursor %q: not a post slug or date", cursor)
+		}
+		rest = posts[i+1:]
+	}
 
-			post := Post{
-				Slug: slug,
-				Title: title,
-				Content: template.HTML(htmlContent),
-				Date: file.ModTime(),
-				Preview: preview,
+	limit := queryInt(query.Get("limit"), 10)
+	if len(rest) > limit {
+		rest = rest[:limit]
+		w.Header().Set("X-Next-Cursor", rest[limit-1].Slug)
+	}
+	return rest, nil
+}
+
+func withNeighbours(post Post, posts []Post) Post {
+	for i := range posts {
+		if posts[i].Slug != post.Slug {
+			continue
+		}
+		if i > 0 {
+			post.NextSlug = posts[i-1].Slug
+			post.NextTitle = posts[i-1].Title
+		}
+		if i < len(posts)-1 {
+			post.PrevSlug = posts[i+1].Slug
+			post.PrevTitle = posts[i+1].Title
+		}
+		break
+	}
+	return post
+}
+
+func seriesPosts(name string, posts []Post) []Post {
+	name = nameSlug(name)
+
+	var parts []Post
+	for _, post := range posts {
+		if post.Series != "" && nameSlug(post.Series) == name {
+			parts = append(parts, post)
+		}
+	}
+
+	sort.SliceStable(parts, func(i, j int) bool {
+		a, b := parts[i], parts[j]
+		if (a.SeriesOrder > 0) != (b.SeriesOrder > 0) {
+			return a.SeriesOrder > 0
+		}
+		if a.SeriesOrder != b.SeriesOrder {
+			return a.SeriesOrder < b.SeriesOrder
+		}
+		return a.Date.Before(b.Date)
+	})
+	return parts
+}
+
+func withSeries(post Post, posts []Post) Post {
+	if post.Series == "" {
+		return post
+	}
+
+	parts := seriesPosts(post.Series, posts)
+	for i := range parts {
+		if parts[i].Slug != post.Slug {
+			continue
+		}
+		post.SeriesPart = i + 1
+		post.SeriesTotal = len(parts)
+		if i > 0 {
+			post.SeriesPrevSlug = parts[i-1].Slug
+			post.SeriesPrevTitle = parts[i-1].Title
+		}
+		if i < len(parts)-1 {
+			post.SeriesNextSlug = parts[i+1].Slug
+			post.SeriesNextTitle = parts[i+1].Title
+		}
+		break
+	}
+	return post
+}
+
+func relatedPosts(post Post, posts []Post, n int) []Post {
+	type scored struct {
+		post Post
+		shared int
+	}
+
+	var candidates []scored
+	for _, other := range posts {
+		if other.Slug == post.Slug {
+			continue
+		}
+
+		shared := 0
+		for _, tag := range post.Tags {
+			if hasTag(other, tag) {
+				shared++
 			}
-			posts = append(posts, post)
+		}
+		if shared > 0 {
+			candidates = append(candidates, scored{other, shared})
 		}
 	}
 
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].Date.After(posts[j].Date)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].shared != candidates[j].shared {
+			return candidates[i].shared > candidates[j].shared
+		}
+		return candidates[i].post.Date.After(candidates[j].post.Date)
 	})
 
-	return posts
+	var related []Post
+	for i := 0; i < len(candidates) && i < n; i++ {
+		related = append(related, candidates[i].post)
+	}
+	return related
+}
+
+func queryInt(s string, fallback int) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return fallback
+	}
+	return n
+}
+
+var fingerprintRe = regexp.MustCompile(`\.[0-9a-f]{8,}\.[a-z0-9]+$`)
+
+func setStaticCacheHeaders(w http.ResponseWriter, urlPath string) {
+	switch {
+	case strings.HasSuffix(urlPath, "/") || path.Ext(urlPath) == ".html":
+		w.Header().Set("Cache-Control", "no-cache")
+	case fingerprintRe.MatchString(urlPath):
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(staticMaxAge.Seconds())))
+	}
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	if templates.Lookup("not-found.html") == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	posts := sortPosts(getPosts(), "date_desc")
+	data := struct{ Recent []Post }{Recent: posts[:min(len(posts), 3)]}
+
+	var html strings.Builder
+	if err := templates.ExecuteTemplate(&html, "not-found.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.NotFound(w, r)
+		return
+	}
+
+	writeHTML(w, http.StatusNotFound, html.String())
 }
 
-func mdToHtml(md []byte) []byte {
-	extensions := parser.CommonExtensions | parser.AutoHeadingIDs
-	p := parser.NewWithExtensions(extensions)
-	doc := p.Parse(md)
+// renderTemplate executes a template into a buffer first, so a failure
+// becomes a 500 error page rather than a truncated 200.
+func renderTemplate(w http.ResponseWriter, name string, data any) {
+	var html strings.Builder
+	if err := templates.ExecuteTemplate(&html, name, data); err != nil {
+		log.Printf("Error executing template %s: %v", name, err)
+		errorPage(w)
+		return
+	}
 
-	htmlFlags := html.CommonFlags | html.HrefTargetBlank
-	opts := html.RendererOptions{Flags: htmlFlags}
-	renderer := html.NewRenderer(opts)
+	writeHTML(w, http.StatusOK, html.String())
+}
+
+func errorPage(w http.ResponseWriter) {
+	if templates.Lookup("error.html") == nil {
+		internalError(w)
+		return
+	}
+
+	data := struct{ RequestID string }{RequestID: w.Header().Get("X-Request-ID")}
+
+	var html strings.Builder
+	if err := templates.ExecuteTemplate(&html, "error.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+		internalError(w)
+		return
+	}
+
+	writeHTML(w, http.StatusInternalServerError, html.String())
+}
+
+func writeHTML(w http.ResponseWriter, status int, html string) {
+	out := blog.MinifyHTML(html)
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.WriteHeader(status)
+	fmt.Fprint(w, out)
+}
+
+func renderCards(w http.ResponseWriter, posts []Post) {
+	var html strings.Builder
+	for i := range posts {
+		err := templates.ExecuteTemplate(&html, "post-card.html", posts[i])
+		if err != nil {
+			log.Printf("Error executing template: %v", err)
+			errorPage(w)
+			return
+		}
+	}
+
+	writeHTML(w, http.StatusOK, html.String())
+}
+
+func searchPosts(posts []Post, q string) []Post {
+	q = strings.ToLower(q)
+
+	var titleMatches, bodyMatches []Post
+	for _, post := range posts {
+		if strings.Contains(strings.ToLower(post.Title), q) {
+			titleMatches = append(titleMatches, post)
+		} else if strings.Contains(strings.ToLower(post.Markdown), q) {
+			bodyMatches = append(bodyMatches, post)
+		}
+	}
+
+	return append(titleMatches, bodyMatches...)
+}
+
+func hasTag(post Post, tag string) bool {
+	for _, t := range post.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
 
-	return markdown.Render(doc, renderer)
+func nameSlug(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), "-"))
 }
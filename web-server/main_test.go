@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alexover1/blog-server/blog"
+)
+
+func loadTestTemplates(t *testing.T) {
+	t.Helper()
+	parsed, err := template.New("").Funcs(templateFuncs).ParseGlob(filepath.Join("templates", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates = parsed
+}
+
+func get(handler http.Handler, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+// loadTestPosts writes files into a temporary -docs directory and loads it.
+func loadTestPosts(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := docsPath
+	docsPath = dir
+	t.Cleanup(func() {
+		docsPath = old
+		postCache.Lock()
+		postCache.all, postCache.posts = nil, nil
+		postCache.Unlock()
+	})
+	reloadPosts()
+}
+
+func TestReloadPostsReadsDocsPath(t *testing.T) {
+	loadTestPosts(t, map[string]string{
+		"hello.md": "# Hello\n\nFirst post.\n",
+	})
+
+	posts := getPosts()
+	if len(posts) != 1 {
+		t.Fatalf("got %d posts, want 1", len(posts))
+	}
+	if posts[0].Slug != "hello" || posts[0].Title != "Hello" {
+		t.Errorf("got slug %q title %q, want hello and Hello", posts[0].Slug, posts[0].Title)
+	}
+}
+
+func TestDraftHiddenFromListingButServedDirectly(t *testing.T) {
+	loadTestTemplates(t)
+	loadTestPosts(t, map[string]string{
+		"public.md": "# Public\n\nVisible.\n",
+		"secret.md": "---\ndraft: true\n---\n# Secret\n\nNot yet.\n",
+	})
+	mux := newMux()
+
+	listing := get(mux, "/api/posts")
+	if !strings.Contains(listing.Body.String(), "Public") || strings.Contains(listing.Body.String(), "Secret") {
+		t.Errorf("listing should show Public and hide the draft:\n%s", listing.Body)
+	}
+
+	if rec := get(mux, "/api/post/secret"); rec.Code != http.StatusNotFound {
+		t.Errorf("draft without -drafts: status %d, want 404", rec.Code)
+	}
+
+	showDrafts = true
+	t.Cleanup(func() { showDrafts = false })
+	rec := get(mux, "/api/post/secret")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Not yet.") {
+		t.Errorf("draft with -drafts: status %d, want 200 with the post body", rec.Code)
+	}
+	if got := rec.Header().Get("X-Robots-Tag"); got != "noindex, nofollow" {
+		t.Errorf("X-Robots-Tag %q, want noindex, nofollow", got)
+	}
+}
+
+func TestNormalizeSlug(t *testing.T) {
+	tests := []struct {
+		in string
+		want string
+		ok bool
+	}{
+		{"hello", "hello", true},
+		{"Hello", "hello", true},
+		{"hello/", "hello", true},
+		{"tech/go", "tech/go", true},
+		{"TECH/Go/", "tech/go", true},
+		{"", "", false},
+		{"/", "", false},
+		{"/etc/passwd", "", false},
+		{"../secret", "", false},
+		{"tech/../secret", "", false},
+		{"./hello", "", false},
+		{"tech//go", "", false},
+		{`tech\go`, "", false},
+		{"hello\x00", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := normalizeSlug(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeSlug(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// Run with -race: handlers read the post cache while a watcher reload
+// replaces it.
+func TestReloadWhileReading(t *testing.T) {
+	loadTestPosts(t, map[string]string{
+		"a.md": "# A\n\nOne.\n",
+		"b.md": "# B\n\nTwo.\n",
+	})
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, post := range getPosts() {
+					_ = post.Title
+				}
+				findPost("a")
+				getAllPosts()
+			}
+		}()
+	}
+
+	for range 20 {
+		reloadPosts()
+	}
+	close(done)
+	wg.Wait()
+
+	if len(getPosts()) != 2 {
+		t.Errorf("got %d posts after reloads, want 2", len(getPosts()))
+	}
+}
+
+func TestStatsHideDrafts(t *testing.T) {
+	loadTestTemplates(t)
+	loadTestPosts(t, map[string]string{
+		"public.md": "# Public\n\nVisible.\n",
+		"secret-launch.md": "---\ndraft: true\n---\n# Secret\n\nNot yet.\n",
+	})
+	previewSecret = "s3cret"
+	t.Cleanup(func() {
+		previewSecret = ""
+		viewStats.Lock()
+		viewStats.counts = nil
+		viewStats.Unlock()
+	})
+	mux := newMux()
+
+	get(mux, "/api/post/public")
+	if rec := get(mux, "/api/post/secret-launch?token="+previewToken("secret-launch")); rec.Code != http.StatusOK {
+		t.Fatalf("preview: status %d, want 200", rec.Code)
+	}
+
+	rec := get(mux, "/api/stats")
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"public":1}` {
+		t.Errorf("stats %s, want only the published post", body)
+	}
+}
+
+func TestTrailingSlashRedirectKeepsLang(t *testing.T) {
+	blog.Languages, blog.DefaultLang = []string{"en", "es"}, "en"
+	t.Cleanup(func() { blog.Languages, blog.DefaultLang = nil, "" })
+	handler := langMiddleware(newMux())
+
+	rec := get(handler, "/es/api/tag/go/?page=2")
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/es/api/tag/go?page=2" {
+		t.Errorf("got %d to %q, want 301 to /es/api/tag/go?page=2", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestLazyRenderListsHash(t *testing.T) {
+	blog.LazyRender = true
+	t.Cleanup(func() { blog.LazyRender = false })
+	loadTestPosts(t, map[string]string{
+		"lazy.md": "# Lazy\n\nRendered on request.\n",
+	})
+	mux := newMux()
+
+	var list []postSummary
+	if err := json.Unmarshal(get(mux, "/api/posts.json").Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	var detail postDetail
+	if err := json.Unmarshal(get(mux, "/api/post/lazy.json").Body.Bytes(), &detail); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].Hash == "" || list[0].Hash != detail.Hash {
+		t.Errorf("listing %+v and post hash %q, want the same non-empty hash", list, detail.Hash)
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	loadTestPosts(t, map[string]string{
+		"pinned.md": "---\ndate: 2024-01-01\npinned: true\n---\n# Pinned\n\nOld but pinned.\n",
+		"c.md": "---\ndate: 2024-04-01\n---\n# C\n\nNewest.\n",
+		"b.md": "---\ndate: 2024-03-01\n---\n# B\n\nMiddle.\n",
+		"a.md": "---\ndate: 2024-02-01\n---\n# A\n\nOlder.\n",
+	})
+	mux := newMux()
+
+	slugs := func(rec *httptest.ResponseRecorder) []string {
+		var list []postSummary
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("%v in %s", err, rec.Body)
+		}
+		var out []string
+		for _, post := range list {
+			out = append(out, post.Slug)
+		}
+		return out
+	}
+
+	rec := get(mux, "/api/posts.json?before=2024-03-15&limit=2")
+	if got := slugs(rec); strings.Join(got, ",") != "b,a" || rec.Header().Get("X-Next-Cursor") != "a" {
+		t.Errorf("date cursor: got %q next %q, want b,a then a", got, rec.Header().Get("X-Next-Cursor"))
+	}
+	if got := slugs(get(mux, "/api/posts.json?before=a&limit=2")); strings.Join(got, ",") != "pinned" {
+		t.Errorf("slug cursor: got %q, want only the older pinned post", got)
+	}
+
+	if rec := get(mux, "/api/posts.json?before=no-such-post"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown cursor: status %d, want 400", rec.Code)
+	}
+}
+
+func TestProbesSkipBasePath(t *testing.T) {
+	loadTestPosts(t, map[string]string{"hello.md": "# Hello\n\nHi.\n"})
+	handler := basePathMiddleware(newMux(), "/blog")
+
+	for _, target := range []string{"/healthz", "/readyz", "/blog/healthz"} {
+		if rec := get(handler, target); rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", target, rec.Code)
+		}
+	}
+	if rec := get(handler, "/api/posts"); rec.Code != http.StatusNotFound {
+		t.Errorf("/api/posts outside the base path: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const gzipMinSize = 1024
+
+var logFormat string
+
+var corsOrigins string
+
+var trailingSlash string
+
+type requestIDKey struct{}
+
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size int
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += n
+	return n, err
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	logger := slog.New(slog.NewJSONHandler(log.Writer(), nil))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		duration := time.Since(start)
+
+		if logFormat == "json" {
+			logger.Info("request",
+				"request_id", requestID(r),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rw.status,
+				"size", rw.size,
+				"duration", duration.String(),
+			)
+			return
+		}
+		log.Printf("%s %s %d %dB %v [%s]", r.Method, r.URL.Path, rw.status, rw.size, duration, requestID(r))
+	})
+}
+
+// getOnly rejects anything but GET and HEAD with 405 Method Not Allowed.
+func getOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// trimTrailingSlash 301-redirects prefix+"name/" to prefix+"name", or with
+// -trailing-slash=strip serves it as though the slash weren't there.
+func trimTrailingSlash(prefix string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trimmed := strings.TrimRight(r.URL.Path, "/")
+		if trimmed == r.URL.Path || len(trimmed) < len(prefix) {
+			next(w, r)
+			return
+		}
+
+		if trailingSlash == "strip" {
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = trimmed
+			r2.URL.RawPath = ""
+			next(w, r2)
+			return
+		}
+
+		target := basePath + langPrefix(r) + (&url.URL{Path: trimmed}).EscapedPath()
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
+
+// requestIDMiddleware tags each request with the caller's X-Request-ID, or a
+// fresh UUID, and echoes it back so errors can be traced across proxies.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRe.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// internalError writes a 500 that carries the request ID for bug reports.
+func internalError(w http.ResponseWriter) {
+	msg := "Internal Server Error"
+	if id := w.Header().Get("X-Request-ID"); id != "" {
+		msg += " (request ID " + id + ")"
+	}
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+// corsMiddleware lets the listed origins (or "*") call the /api/ routes from
+// the browser and answers their preflight requests.
+func corsMiddleware(next http.Handler, origins []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if slices.Contains(origins, "*") {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else if origin != "" && slices.Contains(origins, origin) {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		h.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", "Content-Type, X-Request-ID")
+		h.Set("Access-Control-Expose-Headers", "X-Request-ID, X-Total-Count, X-Total-Pages, X-Next-Cursor")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func basePathMiddleware(next http.Handler, prefix string) http.Handler {
+	stripped := http.StripPrefix(prefix, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == prefix:
+			http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			stripped.ServeHTTP(w, r)
+		case r.URL.Path == "/healthz" || r.URL.Path == "/readyz":
+			// Probes hit the pod directly, without the proxy's prefix.
+			next.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status int
+	buf bytes.Buffer
+	gz *gzip.Writer
+	passthrough bool
+}
+
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.TrimSpace(name) == "gzip" && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	w.status = status
+	if status == http.StatusNotModified || status == http.StatusNoContent || status < 200 {
+		w.start(false)
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf.Write(p)
+	if w.buf.Len() >= gzipMinSize {
+		if err := w.start(compressible(w.Header())); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *gzipResponseWriter) start(compress bool) error {
+	h := w.Header()
+	if h.Get("Content-Type") == "" && w.buf.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+
+	if compress && compressible(h) && w.status != http.StatusPartialContent {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.ResponseWriter.WriteHeader(w.status)
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+		_, err := w.gz.Write(w.buf.Bytes())
+		return err
+	}
+
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
+
+func (w *gzipResponseWriter) Close() error {
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	if !w.passthrough {
+		return w.start(false)
+	}
+	return nil
+}
+
+func compressible(h http.Header) bool {
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+
+	for _, prefix := range []string{"text/", "application/json", "application/xml", "application/rss+xml", "application/atom+xml", "application/feed+json", "application/javascript", "image/svg+xml"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
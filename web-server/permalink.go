@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+const defaultPermalink = "/api/post/:slug"
+
+var permalink string
+
+// permalinkPath expands the -permalink pattern for post, e.g.
+// "/:year/:month/:slug" becomes "/2024/01/my-post".
+func permalinkPath(post Post) string {
+	pattern := permalink
+	if pattern == "" {
+		pattern = defaultPermalink
+	}
+
+	return strings.NewReplacer(
+		":year", post.Date.Format("2006"),
+		":month", post.Date.Format("01"),
+		":day", post.Date.Format("02"),
+		":slug", post.Slug,
+	).Replace(pattern)
+}
+
+// findPermalink returns the post whose permalink is urlPath, if any. Only
+// custom patterns are matched; the default is served by /api/post/.
+func findPermalink(urlPath string) *Post {
+	if permalink == "" {
+		return nil
+	}
+
+	for _, post := range getAllPosts() {
+		if strings.EqualFold(permalinkPath(post), urlPath) {
+			return findPost(post.Slug)
+		}
+	}
+	return nil
+}
+
+// permalinkURL is the escaped link to post including the base path.
+func permalinkURL(post Post) string {
+	return basePath + (&url.URL{Path: permalinkPath(post)}).EscapedPath()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+var previewSecret string
+
+// previewToken is the ?token= value that unlocks one draft, so a single post
+// can be shared for review without enabling -drafts.
+func previewToken(slug string) string {
+	mac := hmac.New(sha256.New, []byte(previewSecret))
+	mac.Write([]byte(slug))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// draftVisible reports whether post may be served for r: published posts
+// always, drafts with -drafts or a valid preview token.
+func draftVisible(r *http.Request, post Post) bool {
+	if !post.Draft || showDrafts {
+		return true
+	}
+	if previewSecret == "" {
+		return false
+	}
+	token := r.URL.Query().Get("token")
+	return hmac.Equal([]byte(token), []byte(previewToken(post.Slug)))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var noIndex bool
+
+type sitemapURLSet struct {
+	XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+}
+
+func handleSitemap(w http.ResponseWriter, r *http.Request) {
+	posts := getPosts()
+
+	home := sitemapURL{
+		Loc: siteURL("/"),
+		ChangeFreq: "daily",
+	}
+	if len(posts) > 0 {
+		home.LastMod = feedUpdated(posts).Format(time.RFC3339)
+	}
+
+	urlset := sitemapURLSet{URLs: []sitemapURL{home}}
+	for _, post := range posts {
+		urlset.URLs = append(urlset.URLs, sitemapURL{
+			Loc: postURL(post),
+			LastMod: post.Date.Format(time.RFC3339),
+			ChangeFreq: "monthly",
+		})
+	}
+
+	writeXML(w, r, "application/xml", urlset, feedUpdated(posts))
+}
+
+func handleRobots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if noIndex {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /\n")
+		return
+	}
+	fmt.Fprintf(w, "User-agent: *\nAllow: /\n\nSitemap: %s\n", siteURL("/sitemap.xml"))
+}
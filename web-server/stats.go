@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const statsFlushInterval = 30 * time.Second
+
+var statsFile string
+
+// viewStats counts post views in memory; a background loop writes them to
+// -stats-file so requests never wait on disk.
+var viewStats struct {
+	sync.Mutex
+	counts map[string]int64
+	dirty bool
+}
+
+func recordView(slug string) {
+	viewStats.Lock()
+	defer viewStats.Unlock()
+	if viewStats.counts == nil {
+		viewStats.counts = map[string]int64{}
+	}
+	viewStats.counts[slug]++
+	viewStats.dirty = true
+}
+
+// statsSnapshot copies the counts for published posts only, so a preview
+// view can't leak a draft's slug.
+func statsSnapshot() map[string]int64 {
+	viewStats.Lock()
+	defer viewStats.Unlock()
+	counts := map[string]int64{}
+	for _, post := range getPosts() {
+		if n, ok := viewStats.counts[post.Slug]; ok {
+			counts[post.Slug] = n
+		}
+	}
+	return counts
+}
+
+// loadStats restores counts saved by an earlier run. A missing file is not
+// an error, since it's created on the first flush.
+func loadStats(file string) error {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var counts map[string]int64
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return err
+	}
+
+	viewStats.Lock()
+	viewStats.counts = counts
+	viewStats.Unlock()
+	return nil
+}
+
+// saveStats writes the counts if they changed since the last save, through a
+// temporary file so a crash can't leave it half written.
+func saveStats(file string) error {
+	viewStats.Lock()
+	if !viewStats.dirty {
+		viewStats.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(viewStats.counts)
+	viewStats.dirty = false
+	viewStats.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func flushStatsPeriodically(file string) {
+	go func() {
+		for range time.Tick(statsFlushInterval) {
+			if err := saveStats(file); err != nil {
+				log.Printf("Error saving stats: %v", err)
+			}
+		}
+	}()
+}
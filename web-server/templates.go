@@ -0,0 +1,39 @@
+package main
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alexover1/blog-server/blog"
+)
+
+// templateFuncs are available in every template:
+//
+//	basePath           the site's URL prefix, e.g. "/blog"
+//	nameSlug NAME      author/series name as used in URLs
+//	formatDate LAYOUT  {{.Date | formatDate "Jan 2, 2006"}}
+//	truncate N         {{.Title | truncate 40}}, ends on a whole word
+//	slugURL SLUG       escaped link to a post, including the base path
+//	permalink POST     the post's -permalink URL, including the base path
+//	safeHTML S         marks trusted markup so it isn't escaped
+//	criticalCSS        contents of the -critical-css file, or empty
+var templateFuncs = template.FuncMap{
+	"basePath": func() string { return basePath },
+	"nameSlug": nameSlug,
+	"formatDate": func(layout string, t time.Time) string { return t.Format(layout) },
+	"truncate": func(n int, s string) string { return blog.Truncate(s, n) },
+	"slugURL": slugURL,
+	"permalink": permalinkURL,
+	"safeHTML": func(s string) template.HTML { return template.HTML(s) },
+	"criticalCSS": func() template.CSS { return criticalCSS },
+}
+
+func slugURL(slug string) string {
+	segments := strings.Split(slug, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return basePath + "/api/post/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+	"time"
+)
+
+// templateFuncsDoc uses every helper in templateFuncs, one per line.
+const templateFuncsDoc = `basePath: {{basePath}}
+nameSlug: {{nameSlug "Jane Doe"}}
+formatDate: {{.Date | formatDate "Jan 2, 2006"}}
+truncate: {{.Title | truncate 12}}
+slugURL: {{slugURL "notes/hello world"}}
+permalink: {{permalink .}}
+safeHTML: {{safeHTML "<em>hi</em>"}}
+criticalCSS: <style>{{criticalCSS}}</style>`
+
+func TestTemplateFuncs(t *testing.T) {
+	oldBase, oldCSS := basePath, criticalCSS
+	basePath, criticalCSS = "/blog", "body{margin:0}"
+	t.Cleanup(func() { basePath, criticalCSS = oldBase, oldCSS })
+
+	for name := range templateFuncs {
+		if !strings.Contains(templateFuncsDoc, "{{"+name) && !strings.Contains(templateFuncsDoc, "| "+name) {
+			t.Errorf("templateFuncsDoc doesn't exercise %s", name)
+		}
+	}
+
+	tmpl := template.Must(template.New("funcs").Funcs(templateFuncs).Parse(templateFuncsDoc))
+	post := Post{
+		Slug: "hello",
+		Title: "A rather long title",
+		Date: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, post); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `basePath: /blog
+nameSlug: jane-doe
+formatDate: Mar 4, 2024
+truncate: A rather...
+slugURL: /blog/api/post/notes/hello%20world
+permalink: /blog/api/post/hello
+safeHTML: <em>hi</em>
+criticalCSS: <style>body{margin:0}</style>`
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "net/http"
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "dev"
+	commit = "unknown"
+	buildTime = "unknown"
+)
+
+type versionInfo struct {
+	Version string `json:"version"`
+	Commit string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, versionInfo{Version: version, Commit: commit, BuildTime: buildTime})
+}